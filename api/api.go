@@ -0,0 +1,9 @@
+// Package api holds the OpenAPI document generated from proto/user/v1.
+package api
+
+import (
+	_ "embed"
+)
+
+//go:embed openapi.yaml
+var OpenAPI []byte
@@ -0,0 +1,212 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gorobot-nz/test-task/api"
+	userv1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const schemaRefPrefix = "#/components/schemas/"
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+
+	doc, err := openapi3.NewLoader().LoadFromData(api.OpenAPI)
+	if err != nil {
+		t.Fatalf("Failed to load spec: %v", err)
+	}
+
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("Invalid spec: %v", err)
+	}
+
+	return doc
+}
+
+// httpRule returns the method and path the gateway serves rpc on.
+func httpRule(t *testing.T, rpc protoreflect.MethodDescriptor) (string, string, string) {
+	t.Helper()
+
+	rule, ok := proto.GetExtension(rpc.Options(), annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil {
+		t.Fatalf("%s has no http rule", rpc.Name())
+	}
+
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return http.MethodGet, pattern.Get, rule.GetBody()
+	case *annotations.HttpRule_Post:
+		return http.MethodPost, pattern.Post, rule.GetBody()
+	case *annotations.HttpRule_Put:
+		return http.MethodPut, pattern.Put, rule.GetBody()
+	case *annotations.HttpRule_Patch:
+		return http.MethodPatch, pattern.Patch, rule.GetBody()
+	case *annotations.HttpRule_Delete:
+		return http.MethodDelete, pattern.Delete, rule.GetBody()
+	}
+
+	t.Fatalf("%s has an unsupported http rule", rpc.Name())
+	return "", "", ""
+}
+
+func schemaName(ref string) string {
+	return strings.TrimPrefix(ref, schemaRefPrefix)
+}
+
+// TestSpecMatchesRoutes fails when an rpc's http rule, which the gateway
+// routes are generated from, isn't documented as is, or when the spec
+// documents an operation no rpc serves.
+func TestSpecMatchesRoutes(t *testing.T) {
+	doc := loadSpec(t)
+
+	service := userv1.File_proto_user_v1_user_proto.Services().ByName("UserService")
+	documented := make(map[string]struct{})
+
+	methods := service.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		rpc := methods.Get(i)
+		method, path, body := httpRule(t, rpc)
+		operationId := "UserService_" + string(rpc.Name())
+		documented[operationId] = struct{}{}
+
+		item := doc.Paths.Find(path)
+		if item == nil {
+			t.Errorf("%s: %s %s isn't documented", rpc.Name(), method, path)
+			continue
+		}
+
+		operation := item.GetOperation(method)
+		if operation == nil {
+			t.Errorf("%s: %s %s isn't documented", rpc.Name(), method, path)
+			continue
+		}
+
+		if operation.OperationID != operationId {
+			t.Errorf("%s %s: got operation %s, want %s", method, path, operation.OperationID, operationId)
+		}
+
+		var pathParams []string
+		for _, match := range pathParam.FindAllStringSubmatch(path, -1) {
+			pathParams = append(pathParams, match[1])
+			if param := operation.Parameters.GetByInAndName(openapi3.ParameterInPath, match[1]); param == nil {
+				t.Errorf("%s: path parameter %s isn't documented", operationId, match[1])
+			}
+		}
+
+		// Without a body, the remaining request fields are query parameters.
+		if body == "" {
+			var want []string
+			fields := rpc.Input().Fields()
+			for j := 0; j < fields.Len(); j++ {
+				if field := fields.Get(j); !slices.Contains(pathParams, string(field.Name())) {
+					want = append(want, field.JSONName())
+				}
+			}
+
+			var got []string
+			for _, param := range operation.Parameters {
+				if param.Value.In == openapi3.ParameterInQuery {
+					got = append(got, param.Value.Name)
+				}
+			}
+
+			slices.Sort(want)
+			slices.Sort(got)
+			if !slices.Equal(got, want) {
+				t.Errorf("%s: documented query parameters %v, want %v", operationId, got, want)
+			}
+		}
+
+		if (body != "") != (operation.RequestBody != nil) {
+			t.Errorf("%s: request body documented: %t, rule has body: %t", operationId, operation.RequestBody != nil, body != "")
+		}
+		if body == "*" && operation.RequestBody != nil {
+			ref := operation.RequestBody.Value.Content.Get("application/json").Schema.Ref
+			if got, want := schemaName(ref), string(rpc.Input().Name()); got != want {
+				t.Errorf("%s: request body is %s, want %s", operationId, got, want)
+			}
+		}
+
+		response := operation.Responses.Status(http.StatusOK)
+		if response == nil {
+			t.Errorf("%s: no 200 response", operationId)
+			continue
+		}
+		ref := response.Value.Content.Get("application/json").Schema.Ref
+		if got, want := schemaName(ref), string(rpc.Output().Name()); got != want {
+			t.Errorf("%s: response is %s, want %s", operationId, got, want)
+		}
+	}
+
+	for path, item := range doc.Paths.Map() {
+		for method, operation := range item.Operations() {
+			if _, ok := documented[operation.OperationID]; !ok {
+				t.Errorf("%s %s: operation %s has no rpc", method, path, operation.OperationID)
+			}
+		}
+	}
+}
+
+// TestSpecMatchesMessages fails when a documented schema's properties or
+// enum values differ from the fields of the message it's named after.
+// Request messages of rpcs without a body are checked as query parameters
+// instead.
+func TestSpecMatchesMessages(t *testing.T) {
+	doc := loadSpec(t)
+
+	messages := userv1.File_proto_user_v1_user_proto.Messages()
+	for i := 0; i < messages.Len(); i++ {
+		message := messages.Get(i)
+
+		ref, ok := doc.Components.Schemas[string(message.Name())]
+		if !ok {
+			continue
+		}
+		schema := ref.Value
+
+		fields := message.Fields()
+		want := make([]string, 0, fields.Len())
+		for j := 0; j < fields.Len(); j++ {
+			field := fields.Get(j)
+			want = append(want, field.JSONName())
+
+			property, ok := schema.Properties[field.JSONName()]
+			if !ok || field.Enum() == nil {
+				continue
+			}
+
+			values := field.Enum().Values()
+			enum := make([]any, 0, values.Len())
+			for k := 0; k < values.Len(); k++ {
+				enum = append(enum, string(values.Get(k).Name()))
+			}
+			if !slices.Equal(property.Value.Enum, enum) {
+				t.Errorf("%s.%s: documented values %v, want %v", message.Name(), field.JSONName(), property.Value.Enum, enum)
+			}
+		}
+
+		got := make([]string, 0, len(schema.Properties))
+		for name := range schema.Properties {
+			got = append(got, name)
+		}
+
+		slices.Sort(want)
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: documented properties %v, want %v", message.Name(), got, want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	userv1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
+	"github.com/gorobot-nz/test-task/pkg/encryption"
+	"github.com/gorobot-nz/test-task/pkg/password"
+)
+
+func main() {
+	storePath := flag.String("store", "users_store.txt", "path to the persisted user store")
+	keyFile := flag.String("keys", os.Getenv("PEPPER_KEY_FILE"), "path to the pepper key file")
+	storeKeyFile := flag.String("store-keys", os.Getenv("STORE_KEY_FILE"), "path to the store key file, if the store is encrypted")
+	flag.Parse()
+
+	if *keyFile == "" {
+		fmt.Fprintln(os.Stderr, "pepper key file is required")
+		os.Exit(2)
+	}
+
+	peppers, err := password.LoadPeppers(*keyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to load peppers:", err)
+		os.Exit(1)
+	}
+
+	var storeKeys *encryption.Keyring
+	if *storeKeyFile != "" {
+		storeKeys, err = encryption.LoadKeyring(*storeKeyFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to load store keys:", err)
+			os.Exit(1)
+		}
+	}
+
+	data, err := encryption.ReadFile(storeKeys, "users", *storePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to open store:", err)
+		os.Exit(1)
+	}
+
+	counts := make(map[string]int)
+	total := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for scanner.Scan() {
+		var user userv1.User
+		if err := json.Unmarshal(scanner.Bytes(), &user); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to load user:", err)
+			os.Exit(1)
+		}
+		counts[password.KeyID(user.GetPassword())]++
+		total++
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to read store:", err)
+		os.Exit(1)
+	}
+
+	ids := make([]string, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tUSERS\t")
+
+	stale := 0
+	for _, id := range ids {
+		name, note := id, ""
+		switch {
+		case id == "":
+			name = "(none)"
+		case id == peppers.Current():
+			note = "current"
+		}
+		if id != peppers.Current() {
+			stale += counts[id]
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", name, counts[id], note)
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d of %d users still on old keys\n", stale, total)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gorobot-nz/test-task/pkg/encryption"
+)
+
+// store-reencrypt rewrites persisted stores under the current key of the
+// store key file. Run it after appending a new key, before dropping the old
+// one; plaintext stores are encrypted on the way. Stores are given by name
+// and read from <name>_store.txt in the working directory, like the server
+// does, since each is sealed for its name.
+func main() {
+	keyFile := flag.String("keys", os.Getenv("STORE_KEY_FILE"), "path to the store key file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-keys file] [store ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *keyFile == "" {
+		fmt.Fprintln(os.Stderr, "store key file is required")
+		os.Exit(2)
+	}
+
+	keyring, err := encryption.LoadKeyring(*keyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to load store keys:", err)
+		os.Exit(1)
+	}
+
+	stores := flag.Args()
+	if len(stores) == 0 {
+		stores = []string{"users", "api_keys"}
+	}
+
+	failed := false
+
+	for _, store := range stores {
+		path := store + "_store.txt"
+		from, err := reencrypt(keyring, store, path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: %s -> %s\n", path, from, keyring.Current())
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func reencrypt(keyring *encryption.Keyring, store, path string) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	from := "plaintext"
+	if encryption.IsEnvelope(raw) {
+		from, err = encryption.EnvelopeKeyId(raw)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	data, err := encryption.ReadFile(keyring, store, path)
+	if err != nil {
+		return "", err
+	}
+
+	return from, encryption.WriteFile(keyring, store, path, data)
+}
@@ -0,0 +1,791 @@
+// Code generated by protoc-gen-connect-go. DO NOT EDIT.
+//
+// Source: proto/user/v1/user.proto
+
+package v1connect
+
+import (
+	connect "connectrpc.com/connect"
+	context "context"
+	errors "errors"
+	v1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
+	http "net/http"
+	strings "strings"
+)
+
+// This is a compile-time assertion to ensure that this generated file and the connect package are
+// compatible. If you get a compiler error that this constant is not defined, this code was
+// generated with a version of connect newer than the one compiled into your binary. You can fix the
+// problem by either regenerating this code with an older version of connect or updating the connect
+// version compiled into your binary.
+const _ = connect.IsAtLeastVersion1_13_0
+
+const (
+	// UserServiceName is the fully-qualified name of the UserService service.
+	UserServiceName = "user.UserService"
+)
+
+// These constants are the fully-qualified names of the RPCs defined in this package. They're
+// exposed at runtime as Spec.Procedure and as the final two segments of the HTTP route.
+//
+// Note that these are different from the fully-qualified method names used by
+// google.golang.org/protobuf/reflect/protoreflect. To convert from these constants to
+// reflection-formatted method names, remove the leading slash and convert the remaining slash to a
+// period.
+const (
+	// UserServiceNewUserProcedure is the fully-qualified name of the UserService's NewUser RPC.
+	UserServiceNewUserProcedure = "/user.UserService/NewUser"
+	// UserServiceGetUsersProcedure is the fully-qualified name of the UserService's GetUsers RPC.
+	UserServiceGetUsersProcedure = "/user.UserService/GetUsers"
+	// UserServiceGetUserByIdProcedure is the fully-qualified name of the UserService's GetUserById RPC.
+	UserServiceGetUserByIdProcedure = "/user.UserService/GetUserById"
+	// UserServiceGetUserByUsernameProcedure is the fully-qualified name of the UserService's
+	// GetUserByUsername RPC.
+	UserServiceGetUserByUsernameProcedure = "/user.UserService/GetUserByUsername"
+	// UserServiceUpdateUserProcedure is the fully-qualified name of the UserService's UpdateUser RPC.
+	UserServiceUpdateUserProcedure = "/user.UserService/UpdateUser"
+	// UserServiceDeleteUserProcedure is the fully-qualified name of the UserService's DeleteUser RPC.
+	UserServiceDeleteUserProcedure = "/user.UserService/DeleteUser"
+	// UserServiceGetMeProcedure is the fully-qualified name of the UserService's GetMe RPC.
+	UserServiceGetMeProcedure = "/user.UserService/GetMe"
+	// UserServiceUpdateMeProcedure is the fully-qualified name of the UserService's UpdateMe RPC.
+	UserServiceUpdateMeProcedure = "/user.UserService/UpdateMe"
+	// UserServiceChangePasswordProcedure is the fully-qualified name of the UserService's
+	// ChangePassword RPC.
+	UserServiceChangePasswordProcedure = "/user.UserService/ChangePassword"
+	// UserServiceRequestPasswordResetProcedure is the fully-qualified name of the UserService's
+	// RequestPasswordReset RPC.
+	UserServiceRequestPasswordResetProcedure = "/user.UserService/RequestPasswordReset"
+	// UserServiceResetPasswordProcedure is the fully-qualified name of the UserService's ResetPassword
+	// RPC.
+	UserServiceResetPasswordProcedure = "/user.UserService/ResetPassword"
+	// UserServiceVerifyEmailProcedure is the fully-qualified name of the UserService's VerifyEmail RPC.
+	UserServiceVerifyEmailProcedure = "/user.UserService/VerifyEmail"
+	// UserServiceEnrollTOTPProcedure is the fully-qualified name of the UserService's EnrollTOTP RPC.
+	UserServiceEnrollTOTPProcedure = "/user.UserService/EnrollTOTP"
+	// UserServiceConfirmTOTPProcedure is the fully-qualified name of the UserService's ConfirmTOTP RPC.
+	UserServiceConfirmTOTPProcedure = "/user.UserService/ConfirmTOTP"
+	// UserServiceDisableTOTPProcedure is the fully-qualified name of the UserService's DisableTOTP RPC.
+	UserServiceDisableTOTPProcedure = "/user.UserService/DisableTOTP"
+	// UserServiceCreateApiKeyProcedure is the fully-qualified name of the UserService's CreateApiKey
+	// RPC.
+	UserServiceCreateApiKeyProcedure = "/user.UserService/CreateApiKey"
+	// UserServiceListApiKeysProcedure is the fully-qualified name of the UserService's ListApiKeys RPC.
+	UserServiceListApiKeysProcedure = "/user.UserService/ListApiKeys"
+	// UserServiceRevokeApiKeyProcedure is the fully-qualified name of the UserService's RevokeApiKey
+	// RPC.
+	UserServiceRevokeApiKeyProcedure = "/user.UserService/RevokeApiKey"
+	// UserServiceListLockoutsProcedure is the fully-qualified name of the UserService's ListLockouts
+	// RPC.
+	UserServiceListLockoutsProcedure = "/user.UserService/ListLockouts"
+	// UserServiceClearLockoutProcedure is the fully-qualified name of the UserService's ClearLockout
+	// RPC.
+	UserServiceClearLockoutProcedure = "/user.UserService/ClearLockout"
+	// UserServiceBatchCreateUsersProcedure is the fully-qualified name of the UserService's
+	// BatchCreateUsers RPC.
+	UserServiceBatchCreateUsersProcedure = "/user.UserService/BatchCreateUsers"
+	// UserServiceBatchGetUsersProcedure is the fully-qualified name of the UserService's BatchGetUsers
+	// RPC.
+	UserServiceBatchGetUsersProcedure = "/user.UserService/BatchGetUsers"
+	// UserServiceBatchDeleteUsersProcedure is the fully-qualified name of the UserService's
+	// BatchDeleteUsers RPC.
+	UserServiceBatchDeleteUsersProcedure = "/user.UserService/BatchDeleteUsers"
+	// UserServiceExportUsersProcedure is the fully-qualified name of the UserService's ExportUsers RPC.
+	UserServiceExportUsersProcedure = "/user.UserService/ExportUsers"
+	// UserServiceImportUsersProcedure is the fully-qualified name of the UserService's ImportUsers RPC.
+	UserServiceImportUsersProcedure = "/user.UserService/ImportUsers"
+)
+
+// UserServiceClient is a client for the user.UserService service.
+type UserServiceClient interface {
+	NewUser(context.Context, *connect.Request[v1.NewUserRequest]) (*connect.Response[v1.NewUserResponse], error)
+	GetUsers(context.Context, *connect.Request[v1.GetUsersRequest]) (*connect.Response[v1.GetUsersResponse], error)
+	GetUserById(context.Context, *connect.Request[v1.GetUserByIdRequest]) (*connect.Response[v1.GetUserByIdResponse], error)
+	GetUserByUsername(context.Context, *connect.Request[v1.GetUserByUsernameRequest]) (*connect.Response[v1.GetUserByUsernameResponse], error)
+	UpdateUser(context.Context, *connect.Request[v1.UpdateUserRequest]) (*connect.Response[v1.UpdateUserResponse], error)
+	DeleteUser(context.Context, *connect.Request[v1.DeleteUserRequest]) (*connect.Response[v1.DeleteUserResponse], error)
+	GetMe(context.Context, *connect.Request[v1.GetMeRequest]) (*connect.Response[v1.GetMeResponse], error)
+	UpdateMe(context.Context, *connect.Request[v1.UpdateMeRequest]) (*connect.Response[v1.UpdateMeResponse], error)
+	ChangePassword(context.Context, *connect.Request[v1.ChangePasswordRequest]) (*connect.Response[v1.ChangePasswordResponse], error)
+	RequestPasswordReset(context.Context, *connect.Request[v1.RequestPasswordResetRequest]) (*connect.Response[v1.RequestPasswordResetResponse], error)
+	ResetPassword(context.Context, *connect.Request[v1.ResetPasswordRequest]) (*connect.Response[v1.ResetPasswordResponse], error)
+	VerifyEmail(context.Context, *connect.Request[v1.VerifyEmailRequest]) (*connect.Response[v1.VerifyEmailResponse], error)
+	EnrollTOTP(context.Context, *connect.Request[v1.EnrollTOTPRequest]) (*connect.Response[v1.EnrollTOTPResponse], error)
+	ConfirmTOTP(context.Context, *connect.Request[v1.ConfirmTOTPRequest]) (*connect.Response[v1.ConfirmTOTPResponse], error)
+	DisableTOTP(context.Context, *connect.Request[v1.DisableTOTPRequest]) (*connect.Response[v1.DisableTOTPResponse], error)
+	CreateApiKey(context.Context, *connect.Request[v1.CreateApiKeyRequest]) (*connect.Response[v1.CreateApiKeyResponse], error)
+	ListApiKeys(context.Context, *connect.Request[v1.ListApiKeysRequest]) (*connect.Response[v1.ListApiKeysResponse], error)
+	RevokeApiKey(context.Context, *connect.Request[v1.RevokeApiKeyRequest]) (*connect.Response[v1.RevokeApiKeyResponse], error)
+	ListLockouts(context.Context, *connect.Request[v1.ListLockoutsRequest]) (*connect.Response[v1.ListLockoutsResponse], error)
+	ClearLockout(context.Context, *connect.Request[v1.ClearLockoutRequest]) (*connect.Response[v1.ClearLockoutResponse], error)
+	BatchCreateUsers(context.Context, *connect.Request[v1.BatchCreateUsersRequest]) (*connect.Response[v1.BatchCreateUsersResponse], error)
+	BatchGetUsers(context.Context, *connect.Request[v1.BatchGetUsersRequest]) (*connect.Response[v1.BatchGetUsersResponse], error)
+	BatchDeleteUsers(context.Context, *connect.Request[v1.BatchDeleteUsersRequest]) (*connect.Response[v1.BatchDeleteUsersResponse], error)
+	ExportUsers(context.Context, *connect.Request[v1.ExportUsersRequest]) (*connect.ServerStreamForClient[v1.ExportUsersResponse], error)
+	ImportUsers(context.Context) *connect.ClientStreamForClient[v1.ImportUsersRequest, v1.ImportUsersResponse]
+}
+
+// NewUserServiceClient constructs a client for the user.UserService service. By default, it uses
+// the Connect protocol with the binary Protobuf Codec, asks for gzipped responses, and sends
+// uncompressed requests. To use the gRPC or gRPC-Web protocols, supply the connect.WithGRPC() or
+// connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewUserServiceClient(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) UserServiceClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	userServiceMethods := v1.File_proto_user_v1_user_proto.Services().ByName("UserService").Methods()
+	return &userServiceClient{
+		newUser: connect.NewClient[v1.NewUserRequest, v1.NewUserResponse](
+			httpClient,
+			baseURL+UserServiceNewUserProcedure,
+			connect.WithSchema(userServiceMethods.ByName("NewUser")),
+			connect.WithClientOptions(opts...),
+		),
+		getUsers: connect.NewClient[v1.GetUsersRequest, v1.GetUsersResponse](
+			httpClient,
+			baseURL+UserServiceGetUsersProcedure,
+			connect.WithSchema(userServiceMethods.ByName("GetUsers")),
+			connect.WithClientOptions(opts...),
+		),
+		getUserById: connect.NewClient[v1.GetUserByIdRequest, v1.GetUserByIdResponse](
+			httpClient,
+			baseURL+UserServiceGetUserByIdProcedure,
+			connect.WithSchema(userServiceMethods.ByName("GetUserById")),
+			connect.WithClientOptions(opts...),
+		),
+		getUserByUsername: connect.NewClient[v1.GetUserByUsernameRequest, v1.GetUserByUsernameResponse](
+			httpClient,
+			baseURL+UserServiceGetUserByUsernameProcedure,
+			connect.WithSchema(userServiceMethods.ByName("GetUserByUsername")),
+			connect.WithClientOptions(opts...),
+		),
+		updateUser: connect.NewClient[v1.UpdateUserRequest, v1.UpdateUserResponse](
+			httpClient,
+			baseURL+UserServiceUpdateUserProcedure,
+			connect.WithSchema(userServiceMethods.ByName("UpdateUser")),
+			connect.WithClientOptions(opts...),
+		),
+		deleteUser: connect.NewClient[v1.DeleteUserRequest, v1.DeleteUserResponse](
+			httpClient,
+			baseURL+UserServiceDeleteUserProcedure,
+			connect.WithSchema(userServiceMethods.ByName("DeleteUser")),
+			connect.WithClientOptions(opts...),
+		),
+		getMe: connect.NewClient[v1.GetMeRequest, v1.GetMeResponse](
+			httpClient,
+			baseURL+UserServiceGetMeProcedure,
+			connect.WithSchema(userServiceMethods.ByName("GetMe")),
+			connect.WithClientOptions(opts...),
+		),
+		updateMe: connect.NewClient[v1.UpdateMeRequest, v1.UpdateMeResponse](
+			httpClient,
+			baseURL+UserServiceUpdateMeProcedure,
+			connect.WithSchema(userServiceMethods.ByName("UpdateMe")),
+			connect.WithClientOptions(opts...),
+		),
+		changePassword: connect.NewClient[v1.ChangePasswordRequest, v1.ChangePasswordResponse](
+			httpClient,
+			baseURL+UserServiceChangePasswordProcedure,
+			connect.WithSchema(userServiceMethods.ByName("ChangePassword")),
+			connect.WithClientOptions(opts...),
+		),
+		requestPasswordReset: connect.NewClient[v1.RequestPasswordResetRequest, v1.RequestPasswordResetResponse](
+			httpClient,
+			baseURL+UserServiceRequestPasswordResetProcedure,
+			connect.WithSchema(userServiceMethods.ByName("RequestPasswordReset")),
+			connect.WithClientOptions(opts...),
+		),
+		resetPassword: connect.NewClient[v1.ResetPasswordRequest, v1.ResetPasswordResponse](
+			httpClient,
+			baseURL+UserServiceResetPasswordProcedure,
+			connect.WithSchema(userServiceMethods.ByName("ResetPassword")),
+			connect.WithClientOptions(opts...),
+		),
+		verifyEmail: connect.NewClient[v1.VerifyEmailRequest, v1.VerifyEmailResponse](
+			httpClient,
+			baseURL+UserServiceVerifyEmailProcedure,
+			connect.WithSchema(userServiceMethods.ByName("VerifyEmail")),
+			connect.WithClientOptions(opts...),
+		),
+		enrollTOTP: connect.NewClient[v1.EnrollTOTPRequest, v1.EnrollTOTPResponse](
+			httpClient,
+			baseURL+UserServiceEnrollTOTPProcedure,
+			connect.WithSchema(userServiceMethods.ByName("EnrollTOTP")),
+			connect.WithClientOptions(opts...),
+		),
+		confirmTOTP: connect.NewClient[v1.ConfirmTOTPRequest, v1.ConfirmTOTPResponse](
+			httpClient,
+			baseURL+UserServiceConfirmTOTPProcedure,
+			connect.WithSchema(userServiceMethods.ByName("ConfirmTOTP")),
+			connect.WithClientOptions(opts...),
+		),
+		disableTOTP: connect.NewClient[v1.DisableTOTPRequest, v1.DisableTOTPResponse](
+			httpClient,
+			baseURL+UserServiceDisableTOTPProcedure,
+			connect.WithSchema(userServiceMethods.ByName("DisableTOTP")),
+			connect.WithClientOptions(opts...),
+		),
+		createApiKey: connect.NewClient[v1.CreateApiKeyRequest, v1.CreateApiKeyResponse](
+			httpClient,
+			baseURL+UserServiceCreateApiKeyProcedure,
+			connect.WithSchema(userServiceMethods.ByName("CreateApiKey")),
+			connect.WithClientOptions(opts...),
+		),
+		listApiKeys: connect.NewClient[v1.ListApiKeysRequest, v1.ListApiKeysResponse](
+			httpClient,
+			baseURL+UserServiceListApiKeysProcedure,
+			connect.WithSchema(userServiceMethods.ByName("ListApiKeys")),
+			connect.WithClientOptions(opts...),
+		),
+		revokeApiKey: connect.NewClient[v1.RevokeApiKeyRequest, v1.RevokeApiKeyResponse](
+			httpClient,
+			baseURL+UserServiceRevokeApiKeyProcedure,
+			connect.WithSchema(userServiceMethods.ByName("RevokeApiKey")),
+			connect.WithClientOptions(opts...),
+		),
+		listLockouts: connect.NewClient[v1.ListLockoutsRequest, v1.ListLockoutsResponse](
+			httpClient,
+			baseURL+UserServiceListLockoutsProcedure,
+			connect.WithSchema(userServiceMethods.ByName("ListLockouts")),
+			connect.WithClientOptions(opts...),
+		),
+		clearLockout: connect.NewClient[v1.ClearLockoutRequest, v1.ClearLockoutResponse](
+			httpClient,
+			baseURL+UserServiceClearLockoutProcedure,
+			connect.WithSchema(userServiceMethods.ByName("ClearLockout")),
+			connect.WithClientOptions(opts...),
+		),
+		batchCreateUsers: connect.NewClient[v1.BatchCreateUsersRequest, v1.BatchCreateUsersResponse](
+			httpClient,
+			baseURL+UserServiceBatchCreateUsersProcedure,
+			connect.WithSchema(userServiceMethods.ByName("BatchCreateUsers")),
+			connect.WithClientOptions(opts...),
+		),
+		batchGetUsers: connect.NewClient[v1.BatchGetUsersRequest, v1.BatchGetUsersResponse](
+			httpClient,
+			baseURL+UserServiceBatchGetUsersProcedure,
+			connect.WithSchema(userServiceMethods.ByName("BatchGetUsers")),
+			connect.WithClientOptions(opts...),
+		),
+		batchDeleteUsers: connect.NewClient[v1.BatchDeleteUsersRequest, v1.BatchDeleteUsersResponse](
+			httpClient,
+			baseURL+UserServiceBatchDeleteUsersProcedure,
+			connect.WithSchema(userServiceMethods.ByName("BatchDeleteUsers")),
+			connect.WithClientOptions(opts...),
+		),
+		exportUsers: connect.NewClient[v1.ExportUsersRequest, v1.ExportUsersResponse](
+			httpClient,
+			baseURL+UserServiceExportUsersProcedure,
+			connect.WithSchema(userServiceMethods.ByName("ExportUsers")),
+			connect.WithClientOptions(opts...),
+		),
+		importUsers: connect.NewClient[v1.ImportUsersRequest, v1.ImportUsersResponse](
+			httpClient,
+			baseURL+UserServiceImportUsersProcedure,
+			connect.WithSchema(userServiceMethods.ByName("ImportUsers")),
+			connect.WithClientOptions(opts...),
+		),
+	}
+}
+
+// userServiceClient implements UserServiceClient.
+type userServiceClient struct {
+	newUser              *connect.Client[v1.NewUserRequest, v1.NewUserResponse]
+	getUsers             *connect.Client[v1.GetUsersRequest, v1.GetUsersResponse]
+	getUserById          *connect.Client[v1.GetUserByIdRequest, v1.GetUserByIdResponse]
+	getUserByUsername    *connect.Client[v1.GetUserByUsernameRequest, v1.GetUserByUsernameResponse]
+	updateUser           *connect.Client[v1.UpdateUserRequest, v1.UpdateUserResponse]
+	deleteUser           *connect.Client[v1.DeleteUserRequest, v1.DeleteUserResponse]
+	getMe                *connect.Client[v1.GetMeRequest, v1.GetMeResponse]
+	updateMe             *connect.Client[v1.UpdateMeRequest, v1.UpdateMeResponse]
+	changePassword       *connect.Client[v1.ChangePasswordRequest, v1.ChangePasswordResponse]
+	requestPasswordReset *connect.Client[v1.RequestPasswordResetRequest, v1.RequestPasswordResetResponse]
+	resetPassword        *connect.Client[v1.ResetPasswordRequest, v1.ResetPasswordResponse]
+	verifyEmail          *connect.Client[v1.VerifyEmailRequest, v1.VerifyEmailResponse]
+	enrollTOTP           *connect.Client[v1.EnrollTOTPRequest, v1.EnrollTOTPResponse]
+	confirmTOTP          *connect.Client[v1.ConfirmTOTPRequest, v1.ConfirmTOTPResponse]
+	disableTOTP          *connect.Client[v1.DisableTOTPRequest, v1.DisableTOTPResponse]
+	createApiKey         *connect.Client[v1.CreateApiKeyRequest, v1.CreateApiKeyResponse]
+	listApiKeys          *connect.Client[v1.ListApiKeysRequest, v1.ListApiKeysResponse]
+	revokeApiKey         *connect.Client[v1.RevokeApiKeyRequest, v1.RevokeApiKeyResponse]
+	listLockouts         *connect.Client[v1.ListLockoutsRequest, v1.ListLockoutsResponse]
+	clearLockout         *connect.Client[v1.ClearLockoutRequest, v1.ClearLockoutResponse]
+	batchCreateUsers     *connect.Client[v1.BatchCreateUsersRequest, v1.BatchCreateUsersResponse]
+	batchGetUsers        *connect.Client[v1.BatchGetUsersRequest, v1.BatchGetUsersResponse]
+	batchDeleteUsers     *connect.Client[v1.BatchDeleteUsersRequest, v1.BatchDeleteUsersResponse]
+	exportUsers          *connect.Client[v1.ExportUsersRequest, v1.ExportUsersResponse]
+	importUsers          *connect.Client[v1.ImportUsersRequest, v1.ImportUsersResponse]
+}
+
+// NewUser calls user.UserService.NewUser.
+func (c *userServiceClient) NewUser(ctx context.Context, req *connect.Request[v1.NewUserRequest]) (*connect.Response[v1.NewUserResponse], error) {
+	return c.newUser.CallUnary(ctx, req)
+}
+
+// GetUsers calls user.UserService.GetUsers.
+func (c *userServiceClient) GetUsers(ctx context.Context, req *connect.Request[v1.GetUsersRequest]) (*connect.Response[v1.GetUsersResponse], error) {
+	return c.getUsers.CallUnary(ctx, req)
+}
+
+// GetUserById calls user.UserService.GetUserById.
+func (c *userServiceClient) GetUserById(ctx context.Context, req *connect.Request[v1.GetUserByIdRequest]) (*connect.Response[v1.GetUserByIdResponse], error) {
+	return c.getUserById.CallUnary(ctx, req)
+}
+
+// GetUserByUsername calls user.UserService.GetUserByUsername.
+func (c *userServiceClient) GetUserByUsername(ctx context.Context, req *connect.Request[v1.GetUserByUsernameRequest]) (*connect.Response[v1.GetUserByUsernameResponse], error) {
+	return c.getUserByUsername.CallUnary(ctx, req)
+}
+
+// UpdateUser calls user.UserService.UpdateUser.
+func (c *userServiceClient) UpdateUser(ctx context.Context, req *connect.Request[v1.UpdateUserRequest]) (*connect.Response[v1.UpdateUserResponse], error) {
+	return c.updateUser.CallUnary(ctx, req)
+}
+
+// DeleteUser calls user.UserService.DeleteUser.
+func (c *userServiceClient) DeleteUser(ctx context.Context, req *connect.Request[v1.DeleteUserRequest]) (*connect.Response[v1.DeleteUserResponse], error) {
+	return c.deleteUser.CallUnary(ctx, req)
+}
+
+// GetMe calls user.UserService.GetMe.
+func (c *userServiceClient) GetMe(ctx context.Context, req *connect.Request[v1.GetMeRequest]) (*connect.Response[v1.GetMeResponse], error) {
+	return c.getMe.CallUnary(ctx, req)
+}
+
+// UpdateMe calls user.UserService.UpdateMe.
+func (c *userServiceClient) UpdateMe(ctx context.Context, req *connect.Request[v1.UpdateMeRequest]) (*connect.Response[v1.UpdateMeResponse], error) {
+	return c.updateMe.CallUnary(ctx, req)
+}
+
+// ChangePassword calls user.UserService.ChangePassword.
+func (c *userServiceClient) ChangePassword(ctx context.Context, req *connect.Request[v1.ChangePasswordRequest]) (*connect.Response[v1.ChangePasswordResponse], error) {
+	return c.changePassword.CallUnary(ctx, req)
+}
+
+// RequestPasswordReset calls user.UserService.RequestPasswordReset.
+func (c *userServiceClient) RequestPasswordReset(ctx context.Context, req *connect.Request[v1.RequestPasswordResetRequest]) (*connect.Response[v1.RequestPasswordResetResponse], error) {
+	return c.requestPasswordReset.CallUnary(ctx, req)
+}
+
+// ResetPassword calls user.UserService.ResetPassword.
+func (c *userServiceClient) ResetPassword(ctx context.Context, req *connect.Request[v1.ResetPasswordRequest]) (*connect.Response[v1.ResetPasswordResponse], error) {
+	return c.resetPassword.CallUnary(ctx, req)
+}
+
+// VerifyEmail calls user.UserService.VerifyEmail.
+func (c *userServiceClient) VerifyEmail(ctx context.Context, req *connect.Request[v1.VerifyEmailRequest]) (*connect.Response[v1.VerifyEmailResponse], error) {
+	return c.verifyEmail.CallUnary(ctx, req)
+}
+
+// EnrollTOTP calls user.UserService.EnrollTOTP.
+func (c *userServiceClient) EnrollTOTP(ctx context.Context, req *connect.Request[v1.EnrollTOTPRequest]) (*connect.Response[v1.EnrollTOTPResponse], error) {
+	return c.enrollTOTP.CallUnary(ctx, req)
+}
+
+// ConfirmTOTP calls user.UserService.ConfirmTOTP.
+func (c *userServiceClient) ConfirmTOTP(ctx context.Context, req *connect.Request[v1.ConfirmTOTPRequest]) (*connect.Response[v1.ConfirmTOTPResponse], error) {
+	return c.confirmTOTP.CallUnary(ctx, req)
+}
+
+// DisableTOTP calls user.UserService.DisableTOTP.
+func (c *userServiceClient) DisableTOTP(ctx context.Context, req *connect.Request[v1.DisableTOTPRequest]) (*connect.Response[v1.DisableTOTPResponse], error) {
+	return c.disableTOTP.CallUnary(ctx, req)
+}
+
+// CreateApiKey calls user.UserService.CreateApiKey.
+func (c *userServiceClient) CreateApiKey(ctx context.Context, req *connect.Request[v1.CreateApiKeyRequest]) (*connect.Response[v1.CreateApiKeyResponse], error) {
+	return c.createApiKey.CallUnary(ctx, req)
+}
+
+// ListApiKeys calls user.UserService.ListApiKeys.
+func (c *userServiceClient) ListApiKeys(ctx context.Context, req *connect.Request[v1.ListApiKeysRequest]) (*connect.Response[v1.ListApiKeysResponse], error) {
+	return c.listApiKeys.CallUnary(ctx, req)
+}
+
+// RevokeApiKey calls user.UserService.RevokeApiKey.
+func (c *userServiceClient) RevokeApiKey(ctx context.Context, req *connect.Request[v1.RevokeApiKeyRequest]) (*connect.Response[v1.RevokeApiKeyResponse], error) {
+	return c.revokeApiKey.CallUnary(ctx, req)
+}
+
+// ListLockouts calls user.UserService.ListLockouts.
+func (c *userServiceClient) ListLockouts(ctx context.Context, req *connect.Request[v1.ListLockoutsRequest]) (*connect.Response[v1.ListLockoutsResponse], error) {
+	return c.listLockouts.CallUnary(ctx, req)
+}
+
+// ClearLockout calls user.UserService.ClearLockout.
+func (c *userServiceClient) ClearLockout(ctx context.Context, req *connect.Request[v1.ClearLockoutRequest]) (*connect.Response[v1.ClearLockoutResponse], error) {
+	return c.clearLockout.CallUnary(ctx, req)
+}
+
+// BatchCreateUsers calls user.UserService.BatchCreateUsers.
+func (c *userServiceClient) BatchCreateUsers(ctx context.Context, req *connect.Request[v1.BatchCreateUsersRequest]) (*connect.Response[v1.BatchCreateUsersResponse], error) {
+	return c.batchCreateUsers.CallUnary(ctx, req)
+}
+
+// BatchGetUsers calls user.UserService.BatchGetUsers.
+func (c *userServiceClient) BatchGetUsers(ctx context.Context, req *connect.Request[v1.BatchGetUsersRequest]) (*connect.Response[v1.BatchGetUsersResponse], error) {
+	return c.batchGetUsers.CallUnary(ctx, req)
+}
+
+// BatchDeleteUsers calls user.UserService.BatchDeleteUsers.
+func (c *userServiceClient) BatchDeleteUsers(ctx context.Context, req *connect.Request[v1.BatchDeleteUsersRequest]) (*connect.Response[v1.BatchDeleteUsersResponse], error) {
+	return c.batchDeleteUsers.CallUnary(ctx, req)
+}
+
+// ExportUsers calls user.UserService.ExportUsers.
+func (c *userServiceClient) ExportUsers(ctx context.Context, req *connect.Request[v1.ExportUsersRequest]) (*connect.ServerStreamForClient[v1.ExportUsersResponse], error) {
+	return c.exportUsers.CallServerStream(ctx, req)
+}
+
+// ImportUsers calls user.UserService.ImportUsers.
+func (c *userServiceClient) ImportUsers(ctx context.Context) *connect.ClientStreamForClient[v1.ImportUsersRequest, v1.ImportUsersResponse] {
+	return c.importUsers.CallClientStream(ctx)
+}
+
+// UserServiceHandler is an implementation of the user.UserService service.
+type UserServiceHandler interface {
+	NewUser(context.Context, *connect.Request[v1.NewUserRequest]) (*connect.Response[v1.NewUserResponse], error)
+	GetUsers(context.Context, *connect.Request[v1.GetUsersRequest]) (*connect.Response[v1.GetUsersResponse], error)
+	GetUserById(context.Context, *connect.Request[v1.GetUserByIdRequest]) (*connect.Response[v1.GetUserByIdResponse], error)
+	GetUserByUsername(context.Context, *connect.Request[v1.GetUserByUsernameRequest]) (*connect.Response[v1.GetUserByUsernameResponse], error)
+	UpdateUser(context.Context, *connect.Request[v1.UpdateUserRequest]) (*connect.Response[v1.UpdateUserResponse], error)
+	DeleteUser(context.Context, *connect.Request[v1.DeleteUserRequest]) (*connect.Response[v1.DeleteUserResponse], error)
+	GetMe(context.Context, *connect.Request[v1.GetMeRequest]) (*connect.Response[v1.GetMeResponse], error)
+	UpdateMe(context.Context, *connect.Request[v1.UpdateMeRequest]) (*connect.Response[v1.UpdateMeResponse], error)
+	ChangePassword(context.Context, *connect.Request[v1.ChangePasswordRequest]) (*connect.Response[v1.ChangePasswordResponse], error)
+	RequestPasswordReset(context.Context, *connect.Request[v1.RequestPasswordResetRequest]) (*connect.Response[v1.RequestPasswordResetResponse], error)
+	ResetPassword(context.Context, *connect.Request[v1.ResetPasswordRequest]) (*connect.Response[v1.ResetPasswordResponse], error)
+	VerifyEmail(context.Context, *connect.Request[v1.VerifyEmailRequest]) (*connect.Response[v1.VerifyEmailResponse], error)
+	EnrollTOTP(context.Context, *connect.Request[v1.EnrollTOTPRequest]) (*connect.Response[v1.EnrollTOTPResponse], error)
+	ConfirmTOTP(context.Context, *connect.Request[v1.ConfirmTOTPRequest]) (*connect.Response[v1.ConfirmTOTPResponse], error)
+	DisableTOTP(context.Context, *connect.Request[v1.DisableTOTPRequest]) (*connect.Response[v1.DisableTOTPResponse], error)
+	CreateApiKey(context.Context, *connect.Request[v1.CreateApiKeyRequest]) (*connect.Response[v1.CreateApiKeyResponse], error)
+	ListApiKeys(context.Context, *connect.Request[v1.ListApiKeysRequest]) (*connect.Response[v1.ListApiKeysResponse], error)
+	RevokeApiKey(context.Context, *connect.Request[v1.RevokeApiKeyRequest]) (*connect.Response[v1.RevokeApiKeyResponse], error)
+	ListLockouts(context.Context, *connect.Request[v1.ListLockoutsRequest]) (*connect.Response[v1.ListLockoutsResponse], error)
+	ClearLockout(context.Context, *connect.Request[v1.ClearLockoutRequest]) (*connect.Response[v1.ClearLockoutResponse], error)
+	BatchCreateUsers(context.Context, *connect.Request[v1.BatchCreateUsersRequest]) (*connect.Response[v1.BatchCreateUsersResponse], error)
+	BatchGetUsers(context.Context, *connect.Request[v1.BatchGetUsersRequest]) (*connect.Response[v1.BatchGetUsersResponse], error)
+	BatchDeleteUsers(context.Context, *connect.Request[v1.BatchDeleteUsersRequest]) (*connect.Response[v1.BatchDeleteUsersResponse], error)
+	ExportUsers(context.Context, *connect.Request[v1.ExportUsersRequest], *connect.ServerStream[v1.ExportUsersResponse]) error
+	ImportUsers(context.Context, *connect.ClientStream[v1.ImportUsersRequest]) (*connect.Response[v1.ImportUsersResponse], error)
+}
+
+// NewUserServiceHandler builds an HTTP handler from the service implementation. It returns the path
+// on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewUserServiceHandler(svc UserServiceHandler, opts ...connect.HandlerOption) (string, http.Handler) {
+	userServiceMethods := v1.File_proto_user_v1_user_proto.Services().ByName("UserService").Methods()
+	userServiceNewUserHandler := connect.NewUnaryHandler(
+		UserServiceNewUserProcedure,
+		svc.NewUser,
+		connect.WithSchema(userServiceMethods.ByName("NewUser")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceGetUsersHandler := connect.NewUnaryHandler(
+		UserServiceGetUsersProcedure,
+		svc.GetUsers,
+		connect.WithSchema(userServiceMethods.ByName("GetUsers")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceGetUserByIdHandler := connect.NewUnaryHandler(
+		UserServiceGetUserByIdProcedure,
+		svc.GetUserById,
+		connect.WithSchema(userServiceMethods.ByName("GetUserById")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceGetUserByUsernameHandler := connect.NewUnaryHandler(
+		UserServiceGetUserByUsernameProcedure,
+		svc.GetUserByUsername,
+		connect.WithSchema(userServiceMethods.ByName("GetUserByUsername")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceUpdateUserHandler := connect.NewUnaryHandler(
+		UserServiceUpdateUserProcedure,
+		svc.UpdateUser,
+		connect.WithSchema(userServiceMethods.ByName("UpdateUser")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceDeleteUserHandler := connect.NewUnaryHandler(
+		UserServiceDeleteUserProcedure,
+		svc.DeleteUser,
+		connect.WithSchema(userServiceMethods.ByName("DeleteUser")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceGetMeHandler := connect.NewUnaryHandler(
+		UserServiceGetMeProcedure,
+		svc.GetMe,
+		connect.WithSchema(userServiceMethods.ByName("GetMe")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceUpdateMeHandler := connect.NewUnaryHandler(
+		UserServiceUpdateMeProcedure,
+		svc.UpdateMe,
+		connect.WithSchema(userServiceMethods.ByName("UpdateMe")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceChangePasswordHandler := connect.NewUnaryHandler(
+		UserServiceChangePasswordProcedure,
+		svc.ChangePassword,
+		connect.WithSchema(userServiceMethods.ByName("ChangePassword")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceRequestPasswordResetHandler := connect.NewUnaryHandler(
+		UserServiceRequestPasswordResetProcedure,
+		svc.RequestPasswordReset,
+		connect.WithSchema(userServiceMethods.ByName("RequestPasswordReset")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceResetPasswordHandler := connect.NewUnaryHandler(
+		UserServiceResetPasswordProcedure,
+		svc.ResetPassword,
+		connect.WithSchema(userServiceMethods.ByName("ResetPassword")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceVerifyEmailHandler := connect.NewUnaryHandler(
+		UserServiceVerifyEmailProcedure,
+		svc.VerifyEmail,
+		connect.WithSchema(userServiceMethods.ByName("VerifyEmail")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceEnrollTOTPHandler := connect.NewUnaryHandler(
+		UserServiceEnrollTOTPProcedure,
+		svc.EnrollTOTP,
+		connect.WithSchema(userServiceMethods.ByName("EnrollTOTP")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceConfirmTOTPHandler := connect.NewUnaryHandler(
+		UserServiceConfirmTOTPProcedure,
+		svc.ConfirmTOTP,
+		connect.WithSchema(userServiceMethods.ByName("ConfirmTOTP")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceDisableTOTPHandler := connect.NewUnaryHandler(
+		UserServiceDisableTOTPProcedure,
+		svc.DisableTOTP,
+		connect.WithSchema(userServiceMethods.ByName("DisableTOTP")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceCreateApiKeyHandler := connect.NewUnaryHandler(
+		UserServiceCreateApiKeyProcedure,
+		svc.CreateApiKey,
+		connect.WithSchema(userServiceMethods.ByName("CreateApiKey")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceListApiKeysHandler := connect.NewUnaryHandler(
+		UserServiceListApiKeysProcedure,
+		svc.ListApiKeys,
+		connect.WithSchema(userServiceMethods.ByName("ListApiKeys")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceRevokeApiKeyHandler := connect.NewUnaryHandler(
+		UserServiceRevokeApiKeyProcedure,
+		svc.RevokeApiKey,
+		connect.WithSchema(userServiceMethods.ByName("RevokeApiKey")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceListLockoutsHandler := connect.NewUnaryHandler(
+		UserServiceListLockoutsProcedure,
+		svc.ListLockouts,
+		connect.WithSchema(userServiceMethods.ByName("ListLockouts")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceClearLockoutHandler := connect.NewUnaryHandler(
+		UserServiceClearLockoutProcedure,
+		svc.ClearLockout,
+		connect.WithSchema(userServiceMethods.ByName("ClearLockout")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceBatchCreateUsersHandler := connect.NewUnaryHandler(
+		UserServiceBatchCreateUsersProcedure,
+		svc.BatchCreateUsers,
+		connect.WithSchema(userServiceMethods.ByName("BatchCreateUsers")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceBatchGetUsersHandler := connect.NewUnaryHandler(
+		UserServiceBatchGetUsersProcedure,
+		svc.BatchGetUsers,
+		connect.WithSchema(userServiceMethods.ByName("BatchGetUsers")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceBatchDeleteUsersHandler := connect.NewUnaryHandler(
+		UserServiceBatchDeleteUsersProcedure,
+		svc.BatchDeleteUsers,
+		connect.WithSchema(userServiceMethods.ByName("BatchDeleteUsers")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceExportUsersHandler := connect.NewServerStreamHandler(
+		UserServiceExportUsersProcedure,
+		svc.ExportUsers,
+		connect.WithSchema(userServiceMethods.ByName("ExportUsers")),
+		connect.WithHandlerOptions(opts...),
+	)
+	userServiceImportUsersHandler := connect.NewClientStreamHandler(
+		UserServiceImportUsersProcedure,
+		svc.ImportUsers,
+		connect.WithSchema(userServiceMethods.ByName("ImportUsers")),
+		connect.WithHandlerOptions(opts...),
+	)
+	return "/user.UserService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case UserServiceNewUserProcedure:
+			userServiceNewUserHandler.ServeHTTP(w, r)
+		case UserServiceGetUsersProcedure:
+			userServiceGetUsersHandler.ServeHTTP(w, r)
+		case UserServiceGetUserByIdProcedure:
+			userServiceGetUserByIdHandler.ServeHTTP(w, r)
+		case UserServiceGetUserByUsernameProcedure:
+			userServiceGetUserByUsernameHandler.ServeHTTP(w, r)
+		case UserServiceUpdateUserProcedure:
+			userServiceUpdateUserHandler.ServeHTTP(w, r)
+		case UserServiceDeleteUserProcedure:
+			userServiceDeleteUserHandler.ServeHTTP(w, r)
+		case UserServiceGetMeProcedure:
+			userServiceGetMeHandler.ServeHTTP(w, r)
+		case UserServiceUpdateMeProcedure:
+			userServiceUpdateMeHandler.ServeHTTP(w, r)
+		case UserServiceChangePasswordProcedure:
+			userServiceChangePasswordHandler.ServeHTTP(w, r)
+		case UserServiceRequestPasswordResetProcedure:
+			userServiceRequestPasswordResetHandler.ServeHTTP(w, r)
+		case UserServiceResetPasswordProcedure:
+			userServiceResetPasswordHandler.ServeHTTP(w, r)
+		case UserServiceVerifyEmailProcedure:
+			userServiceVerifyEmailHandler.ServeHTTP(w, r)
+		case UserServiceEnrollTOTPProcedure:
+			userServiceEnrollTOTPHandler.ServeHTTP(w, r)
+		case UserServiceConfirmTOTPProcedure:
+			userServiceConfirmTOTPHandler.ServeHTTP(w, r)
+		case UserServiceDisableTOTPProcedure:
+			userServiceDisableTOTPHandler.ServeHTTP(w, r)
+		case UserServiceCreateApiKeyProcedure:
+			userServiceCreateApiKeyHandler.ServeHTTP(w, r)
+		case UserServiceListApiKeysProcedure:
+			userServiceListApiKeysHandler.ServeHTTP(w, r)
+		case UserServiceRevokeApiKeyProcedure:
+			userServiceRevokeApiKeyHandler.ServeHTTP(w, r)
+		case UserServiceListLockoutsProcedure:
+			userServiceListLockoutsHandler.ServeHTTP(w, r)
+		case UserServiceClearLockoutProcedure:
+			userServiceClearLockoutHandler.ServeHTTP(w, r)
+		case UserServiceBatchCreateUsersProcedure:
+			userServiceBatchCreateUsersHandler.ServeHTTP(w, r)
+		case UserServiceBatchGetUsersProcedure:
+			userServiceBatchGetUsersHandler.ServeHTTP(w, r)
+		case UserServiceBatchDeleteUsersProcedure:
+			userServiceBatchDeleteUsersHandler.ServeHTTP(w, r)
+		case UserServiceExportUsersProcedure:
+			userServiceExportUsersHandler.ServeHTTP(w, r)
+		case UserServiceImportUsersProcedure:
+			userServiceImportUsersHandler.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// UnimplementedUserServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedUserServiceHandler struct{}
+
+func (UnimplementedUserServiceHandler) NewUser(context.Context, *connect.Request[v1.NewUserRequest]) (*connect.Response[v1.NewUserResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.NewUser is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) GetUsers(context.Context, *connect.Request[v1.GetUsersRequest]) (*connect.Response[v1.GetUsersResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.GetUsers is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) GetUserById(context.Context, *connect.Request[v1.GetUserByIdRequest]) (*connect.Response[v1.GetUserByIdResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.GetUserById is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) GetUserByUsername(context.Context, *connect.Request[v1.GetUserByUsernameRequest]) (*connect.Response[v1.GetUserByUsernameResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.GetUserByUsername is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) UpdateUser(context.Context, *connect.Request[v1.UpdateUserRequest]) (*connect.Response[v1.UpdateUserResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.UpdateUser is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) DeleteUser(context.Context, *connect.Request[v1.DeleteUserRequest]) (*connect.Response[v1.DeleteUserResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.DeleteUser is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) GetMe(context.Context, *connect.Request[v1.GetMeRequest]) (*connect.Response[v1.GetMeResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.GetMe is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) UpdateMe(context.Context, *connect.Request[v1.UpdateMeRequest]) (*connect.Response[v1.UpdateMeResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.UpdateMe is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) ChangePassword(context.Context, *connect.Request[v1.ChangePasswordRequest]) (*connect.Response[v1.ChangePasswordResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.ChangePassword is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) RequestPasswordReset(context.Context, *connect.Request[v1.RequestPasswordResetRequest]) (*connect.Response[v1.RequestPasswordResetResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.RequestPasswordReset is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) ResetPassword(context.Context, *connect.Request[v1.ResetPasswordRequest]) (*connect.Response[v1.ResetPasswordResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.ResetPassword is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) VerifyEmail(context.Context, *connect.Request[v1.VerifyEmailRequest]) (*connect.Response[v1.VerifyEmailResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.VerifyEmail is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) EnrollTOTP(context.Context, *connect.Request[v1.EnrollTOTPRequest]) (*connect.Response[v1.EnrollTOTPResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.EnrollTOTP is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) ConfirmTOTP(context.Context, *connect.Request[v1.ConfirmTOTPRequest]) (*connect.Response[v1.ConfirmTOTPResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.ConfirmTOTP is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) DisableTOTP(context.Context, *connect.Request[v1.DisableTOTPRequest]) (*connect.Response[v1.DisableTOTPResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.DisableTOTP is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) CreateApiKey(context.Context, *connect.Request[v1.CreateApiKeyRequest]) (*connect.Response[v1.CreateApiKeyResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.CreateApiKey is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) ListApiKeys(context.Context, *connect.Request[v1.ListApiKeysRequest]) (*connect.Response[v1.ListApiKeysResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.ListApiKeys is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) RevokeApiKey(context.Context, *connect.Request[v1.RevokeApiKeyRequest]) (*connect.Response[v1.RevokeApiKeyResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.RevokeApiKey is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) ListLockouts(context.Context, *connect.Request[v1.ListLockoutsRequest]) (*connect.Response[v1.ListLockoutsResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.ListLockouts is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) ClearLockout(context.Context, *connect.Request[v1.ClearLockoutRequest]) (*connect.Response[v1.ClearLockoutResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.ClearLockout is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) BatchCreateUsers(context.Context, *connect.Request[v1.BatchCreateUsersRequest]) (*connect.Response[v1.BatchCreateUsersResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.BatchCreateUsers is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) BatchGetUsers(context.Context, *connect.Request[v1.BatchGetUsersRequest]) (*connect.Response[v1.BatchGetUsersResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.BatchGetUsers is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) BatchDeleteUsers(context.Context, *connect.Request[v1.BatchDeleteUsersRequest]) (*connect.Response[v1.BatchDeleteUsersResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.BatchDeleteUsers is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) ExportUsers(context.Context, *connect.Request[v1.ExportUsersRequest], *connect.ServerStream[v1.ExportUsersResponse]) error {
+	return connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.ExportUsers is not implemented"))
+}
+
+func (UnimplementedUserServiceHandler) ImportUsers(context.Context, *connect.ClientStream[v1.ImportUsersRequest]) (*connect.Response[v1.ImportUsersResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("user.UserService.ImportUsers is not implemented"))
+}
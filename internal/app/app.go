@@ -2,227 +2,791 @@ package app
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/gorobot-nz/test-task/pkg/middleware"
 	"github.com/joho/godotenv"
-	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/time/rate"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	userv1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
+	"github.com/gorobot-nz/test-task/gen/proto/user/v1/v1connect"
 
+	adminhandler "github.com/gorobot-nz/test-task/internal/handler/admin"
+	connecthandler "github.com/gorobot-nz/test-task/internal/handler/connect/users"
+	gatewayhandler "github.com/gorobot-nz/test-task/internal/handler/gateway"
 	usershandler "github.com/gorobot-nz/test-task/internal/handler/grpc/users"
+	apikeysrepository "github.com/gorobot-nz/test-task/internal/repository/apikeys"
+	tokensrepository "github.com/gorobot-nz/test-task/internal/repository/tokens"
 	usersrepository "github.com/gorobot-nz/test-task/internal/repository/users"
 	usersservice "github.com/gorobot-nz/test-task/internal/service/users"
+	"github.com/gorobot-nz/test-task/pkg/certs"
+	"github.com/gorobot-nz/test-task/pkg/encryption"
 	applogger "github.com/gorobot-nz/test-task/pkg/logger"
+	"github.com/gorobot-nz/test-task/pkg/mailer"
+	"github.com/gorobot-nz/test-task/pkg/memlistener"
+	"github.com/gorobot-nz/test-task/pkg/metrics"
+	"github.com/gorobot-nz/test-task/pkg/password"
 	"github.com/gorobot-nz/test-task/pkg/storage"
+	"github.com/gorobot-nz/test-task/pkg/tracing"
 
 	grpcmiddleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpczap "github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthv1 "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 var (
-	logLevel int
+	loggerConfig    applogger.Config
+	logRedactFields []string
 
 	adminUsername string
 	adminEmail    string
 	adminPassword string
+
+	smtpHost     string
+	smtpPort     int
+	smtpUsername string
+	smtpPassword string
+	smtpFrom     string
+	mailFile     string
+
+	requireVerifiedEmail bool
+
+	totpKey    []byte
+	totpIssuer string
+
+	grpcAddress       string
+	httpAddress       string
+	connectAddress    string
+	adminAddress      string
+	adminHTTPUsername string
+	adminHTTPPassword string
+	corsOrigins       []string
+	tlsCertFile       string
+	tlsKeyFile        string
+	tlsClientCAFile   string
+	tlsClientAuth     tls.ClientAuthType
+	tlsCertIdentity   middleware.CertIdentity
+	tlsReloadInterval time.Duration
+
+	grpcReflection bool
+
+	lockoutConfig middleware.LockoutConfig
+
+	rateLimitConfig middleware.RateLimitConfig
+
+	passwordConfig password.Config
+	pepperKeyFile  string
+
+	storeKeyFile string
+
+	tracingConfig tracing.Config
 )
 
+func durationEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		panic(err)
+	}
+
+	return duration
+}
+
+func intEnv(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		panic(err)
+	}
+
+	return result
+}
+
 func init() {
 	err := godotenv.Load()
 	if err != nil {
 		panic(err.Error())
 	}
 
-	logLevel, err = strconv.Atoi(os.Getenv("LOG_LEVEL"))
+	logLevel, err := strconv.Atoi(os.Getenv("LOG_LEVEL"))
 
 	if err != nil {
 		panic(err)
 	}
 
+	loggerConfig = applogger.Config{
+		Level:            zap.NewAtomicLevelAt(zapcore.Level(logLevel)),
+		Format:           applogger.Format(os.Getenv("LOG_FORMAT")),
+		File:             os.Getenv("LOG_FILE"),
+		MaxSize:          intEnv("LOG_FILE_MAX_SIZE", 100),
+		MaxBackups:       intEnv("LOG_FILE_MAX_BACKUPS", 0),
+		MaxAge:           durationEnv("LOG_FILE_MAX_AGE", 0),
+		RotateInterval:   durationEnv("LOG_FILE_ROTATE_INTERVAL", 0),
+		SampleInitial:    intEnv("LOG_SAMPLING_INITIAL", 100),
+		SampleThereafter: intEnv("LOG_SAMPLING_THEREAFTER", 0),
+	}
+	if value := os.Getenv("LOG_FILE_COMPRESS"); value != "" {
+		loggerConfig.Compress, err = strconv.ParseBool(value)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if value := os.Getenv("LOG_REDACT_FIELDS"); value != "" {
+		for _, field := range strings.Split(value, ",") {
+			logRedactFields = append(logRedactFields, strings.TrimSpace(field))
+		}
+	}
+
 	adminUsername = os.Getenv("ADMIN_USERNAME")
 	adminEmail = os.Getenv("ADMIN_EMAIL")
 	adminPassword = os.Getenv("ADMIN_PASSWORD")
 
+	smtpHost = os.Getenv("SMTP_HOST")
+	if smtpHost != "" {
+		smtpPort, err = strconv.Atoi(os.Getenv("SMTP_PORT"))
+		if err != nil {
+			panic(err)
+		}
+	}
+	smtpUsername = os.Getenv("SMTP_USERNAME")
+	smtpPassword = os.Getenv("SMTP_PASSWORD")
+	smtpFrom = os.Getenv("SMTP_FROM")
+
+	// Only meant for development: the file gets live reset and verification
+	// tokens in plaintext.
+	mailFile = os.Getenv("MAIL_FILE")
+
+	if value := os.Getenv("REQUIRE_VERIFIED_EMAIL"); value != "" {
+		requireVerifiedEmail, err = strconv.ParseBool(value)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if value := os.Getenv("TOTP_ENCRYPTION_KEY"); value != "" {
+		totpKey, err = base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	totpIssuer = os.Getenv("TOTP_ISSUER")
+	if totpIssuer == "" {
+		totpIssuer = "test-task"
+	}
+
+	grpcAddress = os.Getenv("GRPC_ADDRESS")
+	if grpcAddress == "" {
+		grpcAddress = ":8000"
+	}
+
+	httpAddress = os.Getenv("HTTP_ADDRESS")
+	if httpAddress == "" {
+		httpAddress = ":8080"
+	}
+
+	connectAddress = os.Getenv("CONNECT_ADDRESS")
+	if connectAddress == "" {
+		connectAddress = ":8081"
+	}
+
+	adminAddress = os.Getenv("ADMIN_HTTP_ADDRESS")
+	if adminAddress == "" {
+		adminAddress = "127.0.0.1:9090"
+	}
+
+	adminHTTPUsername = os.Getenv("ADMIN_HTTP_USERNAME")
+	if adminHTTPUsername == "" {
+		adminHTTPUsername = "admin"
+	}
+	adminHTTPPassword = os.Getenv("ADMIN_HTTP_PASSWORD")
+
+	if value := os.Getenv("CORS_ALLOWED_ORIGINS"); value != "" {
+		for _, origin := range strings.Split(value, ",") {
+			corsOrigins = append(corsOrigins, strings.TrimSpace(origin))
+		}
+	}
+
+	tlsCertFile = os.Getenv("TLS_CERT_FILE")
+	tlsKeyFile = os.Getenv("TLS_KEY_FILE")
+	tlsClientCAFile = os.Getenv("TLS_CLIENT_CA_FILE")
+
+	switch value := os.Getenv("TLS_CLIENT_AUTH"); value {
+	case "", "none":
+		tlsClientAuth = tls.NoClientCert
+	case "request":
+		tlsClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		tlsClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		panic(fmt.Sprintf("unknown TLS_CLIENT_AUTH %q", value))
+	}
+
+	// Client certificates only authenticate calls to the gRPC listener. The
+	// REST gateway and Connect relay calls over the in-memory listener,
+	// which doesn't carry the caller's certificate, so their callers need
+	// Basic credentials or an API key even when they present one.
+	tlsCertIdentity, err = middleware.ParseCertIdentity(os.Getenv("TLS_CERT_IDENTITY"))
+	if err != nil {
+		panic(err)
+	}
+
+	tlsReloadInterval = durationEnv("TLS_RELOAD_INTERVAL", 30*time.Second)
+
+	if value := os.Getenv("GRPC_REFLECTION"); value != "" {
+		grpcReflection, err = strconv.ParseBool(value)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	lockoutConfig = middleware.LockoutConfig{
+		AccountThreshold: intEnv("LOCKOUT_ACCOUNT_THRESHOLD", 5),
+		PeerThreshold:    intEnv("LOCKOUT_PEER_THRESHOLD", 20),
+		BaseDuration:     durationEnv("LOCKOUT_BASE_DURATION", time.Minute),
+		MaxDuration:      durationEnv("LOCKOUT_MAX_DURATION", time.Hour),
+		ResetAfter:       durationEnv("LOCKOUT_RESET_AFTER", 15*time.Minute),
+	}
+
+	rateLimitConfig = middleware.RateLimitConfig{
+		KeyBy:   middleware.RateLimitByPeer,
+		Default: middleware.RateLimit{Rate: rate.Inf},
+	}
+
+	if value := os.Getenv("RATE_LIMIT_KEY"); value != "" {
+		rateLimitConfig.KeyBy = middleware.RateLimitKey(value)
+		if rateLimitConfig.KeyBy != middleware.RateLimitByPeer && rateLimitConfig.KeyBy != middleware.RateLimitByPrincipal {
+			panic(fmt.Sprintf("unknown RATE_LIMIT_KEY %q", value))
+		}
+	}
+
+	if value := os.Getenv("RATE_LIMIT_DEFAULT"); value != "" {
+		rateLimitConfig.Default, err = middleware.ParseRateLimit(value)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	rateLimitConfig.Methods, err = middleware.ParseRateLimits(os.Getenv("RATE_LIMIT_METHODS"))
+	if err != nil {
+		panic(err)
+	}
+
+	passwordConfig = password.DefaultConfig()
+	if value := os.Getenv("PASSWORD_HASH_ALGORITHM"); value != "" {
+		passwordConfig.Algorithm = password.Algorithm(value)
+	}
+	passwordConfig.BcryptCost = intEnv("BCRYPT_COST", passwordConfig.BcryptCost)
+	passwordConfig.Argon2.Memory = uint32(intEnv("ARGON2_MEMORY", int(passwordConfig.Argon2.Memory)))
+	passwordConfig.Argon2.Iterations = uint32(intEnv("ARGON2_ITERATIONS", int(passwordConfig.Argon2.Iterations)))
+	passwordConfig.Argon2.Parallelism = uint8(intEnv("ARGON2_PARALLELISM", int(passwordConfig.Argon2.Parallelism)))
+
+	pepperKeyFile = os.Getenv("PEPPER_KEY_FILE")
+
+	storeKeyFile = os.Getenv("STORE_KEY_FILE")
+
+	tracingConfig = tracing.Config{
+		Exporter:    tracing.Exporter(os.Getenv("TRACE_EXPORTER")),
+		File:        os.Getenv("TRACE_FILE"),
+		ServiceName: "test-task",
+		SampleRatio: 1,
+	}
+	if tracingConfig.Exporter == tracing.File && tracingConfig.File == "" {
+		tracingConfig.File = "traces.jsonl"
+	}
+	if value := os.Getenv("TRACE_SAMPLE_RATIO"); value != "" {
+		tracingConfig.SampleRatio, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			panic(err)
+		}
+	}
 }
 
 type App struct {
 	logger *zap.Logger
 
-	s     *grpc.Server
-	store *storage.Storage[userv1.User]
+	s           *grpc.Server
+	health      *health.Server
+	readiness   *middleware.Readiness
+	internal    *grpc.Server
+	internalL   *memlistener.Listener
+	http        *http.Server
+	connect     *http.Server
+	admin       *http.Server
+	store       *storage.Storage[*userv1.User]
+	apiKeyStore *storage.Storage[*apikeysrepository.Key]
+	certs       *certs.Reloader
+	hasher      usersservice.PasswordHasher
+	storeKeys   *encryption.Keyring
+
+	shutdownTracing func(context.Context) error
+	closeLogger     func() error
 }
 
 func NewApp() *App {
-	logger := applogger.NewLogger(zapcore.Level(logLevel))
-	store := storage.NewStorage[userv1.User]()
+	logger, closeLogger, err := applogger.NewLogger(loggerConfig)
+	if err != nil {
+		panic(err)
+	}
+	applogger.SetRedaction(userv1.E_Sensitive, logRedactFields)
 
-	repository := usersrepository.NewStorageRepository(logger.Named("UsersRepository"), store)
-	service := usersservice.NewService(logger.Named("UsersService"), repository)
-	handler := usershandler.NewHandler(logger.Named("UsersHandler"), service)
+	shutdownTracing, err := tracing.Setup(context.Background(), tracingConfig)
+	if err != nil {
+		logger.Fatal("Failed to set up tracing", zap.Error(err))
+	}
+	store := storage.NewStorage[*userv1.User]("users")
+	apiKeyStore := storage.NewStorage[*apikeysrepository.Key]("api_keys")
+
+	var mail mailer.Mailer
+	switch {
+	case smtpHost != "":
+		mail = mailer.NewSMTPMailer(smtpHost, smtpPort, smtpUsername, smtpPassword, smtpFrom)
+	case mailFile != "":
+		logger.Warn("Writing mail to a file, which is only meant for development", zap.String("file", mailFile))
+		mail = mailer.NewFileMailer(mailFile)
+	case requireVerifiedEmail:
+		logger.Fatal("REQUIRE_VERIFIED_EMAIL needs a mailer, set SMTP_HOST or, for development, MAIL_FILE")
+	default:
+		logger.Warn("No mailer configured, password resets and verification emails are disabled; set SMTP_HOST or, for development, MAIL_FILE")
+	}
+
+	var secrets *encryption.Cipher
+	if totpKey != nil {
+		var err error
+		secrets, err = encryption.NewCipher(totpKey)
+		if err != nil {
+			logger.Fatal("Failed to create totp cipher", zap.Error(err))
+		}
+	}
+
+	baseHasher, err := password.NewHasher(passwordConfig)
+	if err != nil {
+		logger.Fatal("Failed to create password hasher", zap.Error(err))
+	}
+
+	var hasher usersservice.PasswordHasher = baseHasher
+	if pepperKeyFile != "" {
+		peppers, err := password.LoadPeppers(pepperKeyFile)
+		if err != nil {
+			logger.Fatal("Failed to load peppers", zap.Error(err))
+		}
+		hasher = password.NewPepperedHasher(baseHasher, peppers)
+	}
+
+	var storeKeys *encryption.Keyring
+	if storeKeyFile != "" {
+		storeKeys, err = encryption.LoadKeyring(storeKeyFile)
+		if err != nil {
+			logger.Fatal("Failed to load store keys", zap.Error(err))
+		}
+	}
 
-	server := grpc.NewServer(grpc.UnaryInterceptor(
-		grpcmiddleware.ChainUnaryServer(
-			grpczap.UnaryServerInterceptor(logger),
-			middleware.AuthMiddleware(),
+	repository := usersrepository.NewStorageRepository(logger.Named("UsersRepository"), store)
+	apiKeyRepository := apikeysrepository.NewStorageRepository(logger.Named("ApiKeysRepository"), apiKeyStore)
+	tokenRepository := tokensrepository.NewStorageRepository(logger.Named("TokensRepository"), storage.NewStorage[*tokensrepository.Token]("tokens"))
+	service := usersservice.NewService(logger.Named("UsersService"), repository, tokenRepository, apiKeyRepository, mail, hasher, secrets, usersservice.Config{
+		RequireVerifiedEmail: requireVerifiedEmail,
+		TOTPIssuer:           totpIssuer,
+	})
+	audit := logger.Named("Audit")
+	lockouts := middleware.NewLockoutTracker(lockoutConfig, func(event middleware.LockEvent) {
+		audit.Warn("Lockout triggered",
+			zap.String("kind", string(event.Kind)),
+			zap.String("subject", event.Subject),
+			zap.Int("failures", event.Failures),
+			zap.Time("locked_until", event.LockedUntil),
+		)
+	})
+
+	handler := usershandler.NewHandler(logger.Named("UsersHandler"), service, lockouts)
+
+	rateLimiter := middleware.NewRateLimiter(rateLimitConfig)
+	readiness := middleware.NewReadiness(userv1.UserService_ServiceDesc.ServiceName)
+
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(
+			grpcmiddleware.ChainUnaryServer(
+				middleware.TracingMiddleware(),
+				middleware.MetricsMiddleware(),
+				grpczap.UnaryServerInterceptor(logger),
+				middleware.RequestIdMiddleware(),
+				middleware.RecoveryMiddleware(logger.Named("Recovery")),
+				readiness.UnaryServerInterceptor(),
+				middleware.AuthMiddleware(tlsCertIdentity, lockouts),
+				rateLimiter.UnaryServerInterceptor(),
+			),
 		),
-	))
+		grpc.StreamInterceptor(
+			grpcmiddleware.ChainStreamServer(
+				middleware.StreamTracingMiddleware(),
+				middleware.StreamMetricsMiddleware(),
+				grpczap.StreamServerInterceptor(logger),
+				middleware.StreamRequestIdMiddleware(),
+				middleware.StreamRecoveryMiddleware(logger.Named("Recovery")),
+				readiness.StreamServerInterceptor(),
+				middleware.StreamAuthMiddleware(tlsCertIdentity, lockouts),
+				rateLimiter.StreamServerInterceptor(),
+			),
+		),
+	}
+
+	// The gateway talks to its own plaintext server over an in-memory
+	// listener, so it goes through the same interceptors without TLS.
+	internal := grpc.NewServer(opts...)
+	internalListener := memlistener.New()
+
+	var reloader *certs.Reloader
+	if tlsCertFile != "" {
+		var err error
+		reloader, err = certs.NewReloader(logger.Named("Certs"), tlsCertFile, tlsKeyFile, tlsClientCAFile)
+		if err != nil {
+			logger.Fatal("Failed to load certificates", zap.Error(err))
+		}
+
+		if tlsClientAuth != tls.NoClientCert && tlsClientCAFile == "" {
+			logger.Fatal("Client certificate auth needs TLS_CLIENT_CA_FILE")
+		}
+
+		opts = append(opts, grpc.Creds(credentials.NewTLS(reloader.TLSConfig(tlsClientAuth))))
+	}
+
+	server := grpc.NewServer(opts...)
 
 	userv1.RegisterUserServiceServer(server, handler)
+	userv1.RegisterUserServiceServer(internal, handler)
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthv1.HealthCheckResponse_NOT_SERVING)
+	healthServer.SetServingStatus(userv1.UserService_ServiceDesc.ServiceName, healthv1.HealthCheckResponse_NOT_SERVING)
+	healthv1.RegisterHealthServer(server, healthServer)
+
+	if grpcReflection {
+		reflection.Register(server)
+	}
+
+	conn, err := grpc.NewClient("passthrough:///gateway",
+		grpc.WithContextDialer(internalListener.DialContext),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		logger.Fatal("Failed to create gateway connection", zap.Error(err))
+	}
+
+	gateway, err := gatewayhandler.NewHandler(context.Background(), conn)
+	if err != nil {
+		logger.Fatal("Failed to create gateway", zap.Error(err))
+	}
+
+	httpServer := &http.Server{
+		Addr:              httpAddress,
+		Handler:           gateway,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(v1connect.NewUserServiceHandler(connecthandler.NewHandler(userv1.NewUserServiceClient(conn))))
+
+	connectServer := &http.Server{
+		Addr:              connectAddress,
+		Handler:           connecthandler.WithCORS(mux, corsOrigins),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// The admin listener is meant for the internal network, so it stays
+	// plaintext even when the API is served over TLS. It can change how the
+	// server logs, so it's only started with a password.
+	var adminServer *http.Server
+	if adminHTTPPassword != "" {
+		adminServer = &http.Server{
+			Addr:              adminAddress,
+			Handler:           adminhandler.NewHandler(adminHTTPUsername, adminHTTPPassword, loggerConfig.Level),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+	} else {
+		logger.Warn("Admin HTTP listener disabled, set ADMIN_HTTP_PASSWORD to serve metrics and the log level")
+	}
+
+	// Client certificates are checked here too, but aren't used as an
+	// identity, see TLS_CERT_IDENTITY.
+	if reloader != nil {
+		httpServer.TLSConfig = reloader.TLSConfig(tlsClientAuth)
+		connectServer.TLSConfig = reloader.TLSConfig(tlsClientAuth)
+	} else {
+		// Serve HTTP/2 without TLS for gRPC and Connect streaming clients.
+		connectServer.Handler = h2c.NewHandler(connectServer.Handler, &http2.Server{})
+	}
 
 	return &App{
-		s:      server,
-		logger: logger,
-		store:  store,
+		s:           server,
+		health:      healthServer,
+		readiness:   readiness,
+		internal:    internal,
+		internalL:   internalListener,
+		http:        httpServer,
+		connect:     connectServer,
+		admin:       adminServer,
+		logger:      logger,
+		store:       store,
+		apiKeyStore: apiKeyStore,
+		certs:       reloader,
+		hasher:      hasher,
+		storeKeys:   storeKeys,
+
+		shutdownTracing: shutdownTracing,
+		closeLogger:     closeLogger,
 	}
 }
 
 func (a *App) Run() {
-	a.initStore()
-
-	l, err := net.Listen("tcp", fmt.Sprintf(":%v", "8000"))
+	l, err := net.Listen("tcp", grpcAddress)
 
 	if err != nil {
 		a.logger.Fatal("Failed listen", zap.Error(err))
 	}
 
+	stopWatch := make(chan struct{})
+	if a.certs != nil {
+		go a.certs.Watch(tlsReloadInterval, stopWatch)
+	}
+
 	go func() {
 		a.logger.Fatal("Failed to serve gRPC", zap.Error(a.s.Serve(l)))
 	}()
 
+	go func() {
+		_ = a.internal.Serve(a.internalL)
+	}()
+
+	go a.serveHTTP(a.http, "Failed to serve HTTP")
+	go a.serveHTTP(a.connect, "Failed to serve Connect")
+	if a.admin != nil {
+		go a.serveHTTP(a.admin, "Failed to serve admin HTTP")
+	}
+
+	// The server is already listening so health checks can tell a loading
+	// instance from a dead one. UserService calls get Unavailable until both
+	// stores are loaded.
+	a.initStore()
+	a.initApiKeyStore()
+	a.readiness.SetReady(true)
+	a.health.Resume()
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
 	<-stop
-	a.saveStore()
+	close(stopWatch)
+	a.health.Shutdown()
+	// Writes after the snapshot would be lost.
+	a.readiness.SetReady(false)
+	a.snapshot("users", a.saveStore)
+	a.snapshot("api_keys", a.saveApiKeyStore)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := a.http.Shutdown(ctx); err != nil {
+		a.logger.Error("Failed to shutdown HTTP", zap.Error(err))
+	}
+	if err := a.connect.Shutdown(ctx); err != nil {
+		a.logger.Error("Failed to shutdown Connect", zap.Error(err))
+	}
+	if a.admin != nil {
+		if err := a.admin.Shutdown(ctx); err != nil {
+			a.logger.Error("Failed to shutdown admin HTTP", zap.Error(err))
+		}
+	}
+
+	gracefulStop(ctx, a.internal)
+	gracefulStop(ctx, a.s)
+
+	if err := a.shutdownTracing(ctx); err != nil {
+		a.logger.Error("Failed to shutdown tracing", zap.Error(err))
+	}
+	if err := a.closeLogger(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to close log file: %v\n", err)
+	}
+}
+
+// gracefulStop waits for pending RPCs until ctx is done, then closes the
+// rest, such as health watches, which never finish on their own.
+func gracefulStop(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
 
-	a.s.GracefulStop()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		server.Stop()
+	}
+}
+
+func (a *App) serveHTTP(server *http.Server, msg string) {
+	var err error
+	if server.TLSConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		a.logger.Fatal(msg, zap.Error(err))
+	}
 }
 
 func (a *App) initStore() {
-	file, err := os.Open("users_store.txt")
+	data, err := encryption.ReadFile(a.storeKeys, "users", "users_store.txt")
+	if errors.Is(err, os.ErrNotExist) {
+		a.createAdmin()
+		return
+	}
 	if err != nil {
-		if adminEmail == "" || adminUsername == "" || adminPassword == "" {
-			a.logger.Fatal("No default admin params")
-		}
+		a.logger.Fatal("Failed to read store", zap.Error(err))
+	}
 
-		id := uuid.New().String()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
 
-		password, err := bcrypt.GenerateFromPassword([]byte(adminPassword), 10)
+	for scanner.Scan() {
+		var user userv1.User
+		userBytes := scanner.Bytes()
+		err := json.Unmarshal(userBytes, &user)
 		if err != nil {
-			a.logger.Fatal("Failed to generate password", zap.Error(err))
+			a.logger.Fatal("Failed to load user", zap.Error(err))
 		}
+		a.store.Set(context.Background(), user.GetId(), &user)
+	}
 
-		a.store.Set(id, userv1.User{
-			Id:       id,
-			Email:    adminEmail,
-			Username: adminUsername,
-			Password: string(password),
-			Admin:    true,
-		})
-	} else {
-		defer func(file *os.File) {
-			err := file.Close()
-			if err != nil {
-				a.logger.Error("Failed to close file", zap.Error(err))
-			}
-		}(file)
-
-		scanner := bufio.NewScanner(file)
+	list := a.store.List(context.Background())
 
-		for scanner.Scan() {
-			var user userv1.User
-			userBytes := scanner.Bytes()
-			err := json.Unmarshal(userBytes, &user)
-			if err != nil {
-				a.logger.Fatal("Failed to load user", zap.Error(err))
-			}
-			a.store.Set(user.GetId(), user)
+	for _, val := range list {
+		if val.GetAdmin() {
+			return
 		}
+	}
+
+	a.createAdmin()
+}
 
-		if a.store.Size() == 0 {
-			if adminEmail == "" || adminUsername == "" || adminPassword == "" {
-				a.logger.Fatal("No default admin params")
-			}
+func (a *App) createAdmin() {
+	if adminEmail == "" || adminUsername == "" || adminPassword == "" {
+		a.logger.Fatal("No default admin params")
+	}
 
-			id := uuid.New().String()
+	id := uuid.New().String()
 
-			password, err := bcrypt.GenerateFromPassword([]byte(adminPassword), 10)
-			if err != nil {
-				a.logger.Fatal("Failed to generate password", zap.Error(err))
-			}
+	password, err := a.hasher.Hash(adminPassword)
+	if err != nil {
+		a.logger.Fatal("Failed to generate password", zap.Error(err))
+	}
 
-			a.store.Set(id, userv1.User{
-				Id:       id,
-				Email:    adminEmail,
-				Username: adminUsername,
-				Password: string(password),
-				Admin:    true,
-			})
-		}
+	a.store.Set(context.Background(), id, &userv1.User{
+		Id:            id,
+		Email:         adminEmail,
+		Username:      adminUsername,
+		Password:      password,
+		Admin:         true,
+		EmailVerified: true,
+		CreateTime:    timestamppb.Now(),
+	})
+}
 
-		list := a.store.List()
+// snapshot saves a store to disk, recording how long it took and whether
+// it failed.
+func (a *App) snapshot(store string, save func() error) {
+	start := time.Now()
+	err := save()
+	metrics.SnapshotDuration.WithLabelValues(store).Observe(time.Since(start).Seconds())
 
-		for _, val := range list {
-			if val.GetAdmin() {
-				return
-			}
-		}
+	if err != nil {
+		metrics.SnapshotFailures.WithLabelValues(store).Inc()
+		a.logger.Error("Failed to save store", zap.String("store", store), zap.Error(err))
+	}
+}
 
-		if adminEmail == "" || adminUsername == "" || adminPassword == "" {
-			a.logger.Fatal("No default admin params")
-		}
+func (a *App) saveStore() error {
+	var b bytes.Buffer
 
-		id := uuid.New().String()
+	list := a.store.List(context.Background())
 
-		password, err := bcrypt.GenerateFromPassword([]byte(adminPassword), 10)
+	for _, item := range list {
+		marshal, err := json.Marshal(item)
 		if err != nil {
-			a.logger.Fatal("Failed to generate password", zap.Error(err))
+			return fmt.Errorf("marshal item: %w", err)
 		}
-
-		a.store.Set(id, userv1.User{
-			Id:       id,
-			Email:    adminEmail,
-			Username: adminUsername,
-			Password: string(password),
-			Admin:    true,
-		})
+		b.Write(marshal)
+		b.WriteByte('\n')
 	}
+
+	return encryption.WriteFile(a.storeKeys, "users", "users_store.txt", b.Bytes())
 }
 
-func (a *App) saveStore() {
-	file, err := os.Create("users_store.txt")
-	if err != nil {
-		a.logger.Error("Failed to create file", zap.Error(err))
+func (a *App) initApiKeyStore() {
+	data, err := encryption.ReadFile(a.storeKeys, "api_keys", "api_keys_store.txt")
+	if errors.Is(err, os.ErrNotExist) {
 		return
 	}
-	defer func(file *os.File) {
-		err := file.Close()
+	if err != nil {
+		a.logger.Fatal("Failed to read api key store", zap.Error(err))
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for scanner.Scan() {
+		var key apikeysrepository.Key
+		err := json.Unmarshal(scanner.Bytes(), &key)
 		if err != nil {
-			a.logger.Error("Failed to close file", zap.Error(err))
+			a.logger.Fatal("Failed to load api key", zap.Error(err))
 		}
-	}(file)
+		a.apiKeyStore.Set(context.Background(), key.Id, &key)
+	}
+}
 
-	list := a.store.List()
+func (a *App) saveApiKeyStore() error {
+	var b bytes.Buffer
+
+	list := a.apiKeyStore.List(context.Background())
 
 	for _, item := range list {
-		marshal, err := json.Marshal(&item)
-		if err != nil {
-			a.logger.Error("Failed to marshal item", zap.Error(err))
-			return
-		}
-		_, err = file.WriteString(fmt.Sprintf("%s\n", string(marshal)))
+		marshal, err := json.Marshal(item)
 		if err != nil {
-			a.logger.Error("Failed to write", zap.Error(err))
-			return
+			return fmt.Errorf("marshal item: %w", err)
 		}
+		b.Write(marshal)
+		b.WriteByte('\n')
 	}
+
+	return encryption.WriteFile(a.storeKeys, "api_keys", "api_keys_store.txt", b.Bytes())
 }
@@ -0,0 +1,52 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gorobot-nz/test-task/pkg/metrics"
+
+	"go.uber.org/zap"
+)
+
+const (
+	MetricsPath  = "/metrics"
+	LogLevelPath = "/log/level"
+)
+
+// NewHandler serves the operational endpoints: Prometheus metrics, and the
+// log level, which GET returns and a JSON PUT of {"level":"debug"} changes.
+// Every request needs Basic credentials matching username and password.
+func NewHandler(username, password string, level zap.AtomicLevel) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, metrics.Handler())
+	mux.Handle(LogLevelPath, level)
+
+	return withBasicAuth(mux, username, password)
+}
+
+func withBasicAuth(h http.Handler, username, password string) http.Handler {
+	wantUsername := sha256.Sum256([]byte(username))
+	wantPassword := sha256.Sum256([]byte(password))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+
+		// Hashing first keeps the comparisons constant time regardless of
+		// the lengths involved.
+		gotUsername := sha256.Sum256([]byte(u))
+		gotPassword := sha256.Sum256([]byte(p))
+
+		usernameOk := subtle.ConstantTimeCompare(gotUsername[:], wantUsername[:]) == 1
+		passwordOk := subtle.ConstantTimeCompare(gotPassword[:], wantPassword[:]) == 1
+
+		if !ok || !usernameOk || !passwordOk {
+			w.Header().Set("WWW-Authenticate", `Basic realm="admin", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
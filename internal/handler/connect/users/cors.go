@@ -0,0 +1,39 @@
+package users
+
+import (
+	"net/http"
+
+	"github.com/rs/cors"
+)
+
+// WithCORS allows browsers on origins to call h with the Connect and
+// gRPC-Web protocols. Without origins h is returned unchanged.
+func WithCORS(h http.Handler, origins []string) http.Handler {
+	if len(origins) == 0 {
+		return h
+	}
+
+	return cors.New(cors.Options{
+		AllowedOrigins: origins,
+		AllowedMethods: []string{http.MethodGet, http.MethodPost},
+		AllowedHeaders: []string{
+			"Authorization",
+			"Content-Type",
+			"Connect-Protocol-Version",
+			"Connect-Timeout-Ms",
+			"Grpc-Timeout",
+			"X-Grpc-Web",
+			"X-User-Agent",
+			"X-Totp-Code",
+			"X-Request-Id",
+		},
+		ExposedHeaders: []string{
+			"Grpc-Status",
+			"Grpc-Message",
+			"Grpc-Status-Details-Bin",
+			"Retry-After",
+			"X-Request-Id",
+		},
+		MaxAge: 7200,
+	}).Handler(h)
+}
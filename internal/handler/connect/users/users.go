@@ -0,0 +1,276 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	userv1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
+	"github.com/gorobot-nz/test-task/gen/proto/user/v1/v1connect"
+
+	"connectrpc.com/connect"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const forwardedForHeader = "x-forwarded-for"
+
+// Handler serves UserService over the Connect, gRPC-Web and gRPC protocols
+// by relaying each call to client, so requests pass through the same
+// interceptors as native gRPC ones.
+type Handler struct {
+	client userv1.UserServiceClient
+}
+
+var _ v1connect.UserServiceHandler = (*Handler)(nil)
+
+func NewHandler(client userv1.UserServiceClient) *Handler {
+	return &Handler{client: client}
+}
+
+func skipHeader(key string) bool {
+	switch key {
+	case "content-type", "content-length", "content-encoding", "accept-encoding",
+		"connection", "host", "te", "user-agent", "x-user-agent", "x-grpc-web":
+		return true
+	}
+	return strings.HasPrefix(key, "connect-") || strings.HasPrefix(key, "grpc-")
+}
+
+// outgoing forwards the request headers as metadata and appends the client
+// host to x-forwarded-for, where the auth and rate limit interceptors look
+// for it.
+func outgoing(ctx context.Context, header http.Header, peer connect.Peer) context.Context {
+	md := metadata.MD{}
+
+	for key, values := range header {
+		key = strings.ToLower(key)
+		if skipHeader(key) {
+			continue
+		}
+
+		for _, value := range values {
+			if strings.HasSuffix(key, "-bin") {
+				decoded, err := connect.DecodeBinaryHeader(value)
+				if err != nil {
+					continue
+				}
+				value = string(decoded)
+			}
+			md.Append(key, value)
+		}
+	}
+
+	if host, _, err := net.SplitHostPort(peer.Addr); err == nil {
+		md.Append(forwardedForHeader, host)
+	}
+
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+func copyMetadata(dst http.Header, md metadata.MD) {
+	for key, values := range md {
+		if skipHeader(key) {
+			continue
+		}
+
+		for _, value := range values {
+			if strings.HasSuffix(key, "-bin") {
+				value = connect.EncodeBinaryHeader([]byte(value))
+			}
+			dst.Add(key, value)
+		}
+	}
+}
+
+func connectError(err error, header, trailer metadata.MD) error {
+	st := status.Convert(err)
+
+	connectErr := connect.NewError(connect.Code(st.Code()), errors.New(st.Message()))
+	for _, detail := range st.Proto().GetDetails() {
+		if errorDetail, err := connect.NewErrorDetail(detail); err == nil {
+			connectErr.AddDetail(errorDetail)
+		}
+	}
+
+	copyMetadata(connectErr.Meta(), header)
+	copyMetadata(connectErr.Meta(), trailer)
+
+	return connectErr
+}
+
+type unaryCall[Req, Res any] func(context.Context, *Req, ...grpc.CallOption) (*Res, error)
+
+func unary[Req, Res any](ctx context.Context, req *connect.Request[Req], call unaryCall[Req, Res]) (*connect.Response[Res], error) {
+	var header, trailer metadata.MD
+
+	res, err := call(outgoing(ctx, req.Header(), req.Peer()), req.Msg, grpc.Header(&header), grpc.Trailer(&trailer))
+	if err != nil {
+		return nil, connectError(err, header, trailer)
+	}
+
+	response := connect.NewResponse(res)
+	copyMetadata(response.Header(), header)
+	copyMetadata(response.Trailer(), trailer)
+
+	return response, nil
+}
+
+func (h *Handler) NewUser(ctx context.Context, req *connect.Request[userv1.NewUserRequest]) (*connect.Response[userv1.NewUserResponse], error) {
+	return unary(ctx, req, h.client.NewUser)
+}
+
+func (h *Handler) GetUsers(ctx context.Context, req *connect.Request[userv1.GetUsersRequest]) (*connect.Response[userv1.GetUsersResponse], error) {
+	return unary(ctx, req, h.client.GetUsers)
+}
+
+func (h *Handler) GetUserById(ctx context.Context, req *connect.Request[userv1.GetUserByIdRequest]) (*connect.Response[userv1.GetUserByIdResponse], error) {
+	return unary(ctx, req, h.client.GetUserById)
+}
+
+func (h *Handler) GetUserByUsername(ctx context.Context, req *connect.Request[userv1.GetUserByUsernameRequest]) (*connect.Response[userv1.GetUserByUsernameResponse], error) {
+	return unary(ctx, req, h.client.GetUserByUsername)
+}
+
+func (h *Handler) UpdateUser(ctx context.Context, req *connect.Request[userv1.UpdateUserRequest]) (*connect.Response[userv1.UpdateUserResponse], error) {
+	return unary(ctx, req, h.client.UpdateUser)
+}
+
+func (h *Handler) DeleteUser(ctx context.Context, req *connect.Request[userv1.DeleteUserRequest]) (*connect.Response[userv1.DeleteUserResponse], error) {
+	return unary(ctx, req, h.client.DeleteUser)
+}
+
+func (h *Handler) GetMe(ctx context.Context, req *connect.Request[userv1.GetMeRequest]) (*connect.Response[userv1.GetMeResponse], error) {
+	return unary(ctx, req, h.client.GetMe)
+}
+
+func (h *Handler) UpdateMe(ctx context.Context, req *connect.Request[userv1.UpdateMeRequest]) (*connect.Response[userv1.UpdateMeResponse], error) {
+	return unary(ctx, req, h.client.UpdateMe)
+}
+
+func (h *Handler) ChangePassword(ctx context.Context, req *connect.Request[userv1.ChangePasswordRequest]) (*connect.Response[userv1.ChangePasswordResponse], error) {
+	return unary(ctx, req, h.client.ChangePassword)
+}
+
+func (h *Handler) RequestPasswordReset(ctx context.Context, req *connect.Request[userv1.RequestPasswordResetRequest]) (*connect.Response[userv1.RequestPasswordResetResponse], error) {
+	return unary(ctx, req, h.client.RequestPasswordReset)
+}
+
+func (h *Handler) ResetPassword(ctx context.Context, req *connect.Request[userv1.ResetPasswordRequest]) (*connect.Response[userv1.ResetPasswordResponse], error) {
+	return unary(ctx, req, h.client.ResetPassword)
+}
+
+func (h *Handler) VerifyEmail(ctx context.Context, req *connect.Request[userv1.VerifyEmailRequest]) (*connect.Response[userv1.VerifyEmailResponse], error) {
+	return unary(ctx, req, h.client.VerifyEmail)
+}
+
+func (h *Handler) EnrollTOTP(ctx context.Context, req *connect.Request[userv1.EnrollTOTPRequest]) (*connect.Response[userv1.EnrollTOTPResponse], error) {
+	return unary(ctx, req, h.client.EnrollTOTP)
+}
+
+func (h *Handler) ConfirmTOTP(ctx context.Context, req *connect.Request[userv1.ConfirmTOTPRequest]) (*connect.Response[userv1.ConfirmTOTPResponse], error) {
+	return unary(ctx, req, h.client.ConfirmTOTP)
+}
+
+func (h *Handler) DisableTOTP(ctx context.Context, req *connect.Request[userv1.DisableTOTPRequest]) (*connect.Response[userv1.DisableTOTPResponse], error) {
+	return unary(ctx, req, h.client.DisableTOTP)
+}
+
+func (h *Handler) CreateApiKey(ctx context.Context, req *connect.Request[userv1.CreateApiKeyRequest]) (*connect.Response[userv1.CreateApiKeyResponse], error) {
+	return unary(ctx, req, h.client.CreateApiKey)
+}
+
+func (h *Handler) ListApiKeys(ctx context.Context, req *connect.Request[userv1.ListApiKeysRequest]) (*connect.Response[userv1.ListApiKeysResponse], error) {
+	return unary(ctx, req, h.client.ListApiKeys)
+}
+
+func (h *Handler) RevokeApiKey(ctx context.Context, req *connect.Request[userv1.RevokeApiKeyRequest]) (*connect.Response[userv1.RevokeApiKeyResponse], error) {
+	return unary(ctx, req, h.client.RevokeApiKey)
+}
+
+func (h *Handler) ListLockouts(ctx context.Context, req *connect.Request[userv1.ListLockoutsRequest]) (*connect.Response[userv1.ListLockoutsResponse], error) {
+	return unary(ctx, req, h.client.ListLockouts)
+}
+
+func (h *Handler) ClearLockout(ctx context.Context, req *connect.Request[userv1.ClearLockoutRequest]) (*connect.Response[userv1.ClearLockoutResponse], error) {
+	return unary(ctx, req, h.client.ClearLockout)
+}
+
+func (h *Handler) BatchCreateUsers(ctx context.Context, req *connect.Request[userv1.BatchCreateUsersRequest]) (*connect.Response[userv1.BatchCreateUsersResponse], error) {
+	return unary(ctx, req, h.client.BatchCreateUsers)
+}
+
+func (h *Handler) BatchGetUsers(ctx context.Context, req *connect.Request[userv1.BatchGetUsersRequest]) (*connect.Response[userv1.BatchGetUsersResponse], error) {
+	return unary(ctx, req, h.client.BatchGetUsers)
+}
+
+func (h *Handler) BatchDeleteUsers(ctx context.Context, req *connect.Request[userv1.BatchDeleteUsersRequest]) (*connect.Response[userv1.BatchDeleteUsersResponse], error) {
+	return unary(ctx, req, h.client.BatchDeleteUsers)
+}
+
+func (h *Handler) ExportUsers(ctx context.Context, req *connect.Request[userv1.ExportUsersRequest], stream *connect.ServerStream[userv1.ExportUsersResponse]) error {
+	client, err := h.client.ExportUsers(outgoing(ctx, req.Header(), req.Peer()), req.Msg)
+	if err != nil {
+		return connectError(err, nil, nil)
+	}
+
+	for first := true; ; first = false {
+		msg, err := client.Recv()
+
+		// Headers have to be set before the first message is sent.
+		if first {
+			header, _ := client.Header()
+			copyMetadata(stream.ResponseHeader(), header)
+		}
+
+		if errors.Is(err, io.EOF) {
+			copyMetadata(stream.ResponseTrailer(), client.Trailer())
+			return nil
+		}
+		if err != nil {
+			return connectError(err, nil, client.Trailer())
+		}
+
+		if err := stream.Send(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (h *Handler) ImportUsers(ctx context.Context, stream *connect.ClientStream[userv1.ImportUsersRequest]) (*connect.Response[userv1.ImportUsersResponse], error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var header, trailer metadata.MD
+
+	client, err := h.client.ImportUsers(outgoing(ctx, stream.RequestHeader(), stream.Peer()), grpc.Header(&header), grpc.Trailer(&trailer))
+	if err != nil {
+		return nil, connectError(err, nil, nil)
+	}
+
+	for stream.Receive() {
+		// A failed send means the server ended the call; its status is
+		// returned by CloseAndRecv.
+		if err := client.Send(stream.Msg()); err != nil {
+			break
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+
+	res, err := client.CloseAndRecv()
+	if err != nil {
+		return nil, connectError(err, header, trailer)
+	}
+
+	response := connect.NewResponse(res)
+	copyMetadata(response.Header(), header)
+	copyMetadata(response.Trailer(), trailer)
+
+	return response, nil
+}
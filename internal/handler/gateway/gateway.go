@@ -0,0 +1,84 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/gorobot-nz/test-task/api"
+	userv1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
+	"github.com/gorobot-nz/test-task/pkg/middleware"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const totpCodeHeader = "X-Totp-Code"
+const requestIdHeader = "X-Request-Id"
+const retryAfterHeader = "retry-after"
+
+// OpenAPIPath serves the OpenAPI document describing the gateway routes.
+const OpenAPIPath = "/openapi.yaml"
+
+// marshaler is the gateway's default, except that unset message fields are
+// left out instead of written as null, which the OpenAPI document doesn't
+// allow. Fields with default values are still written.
+var marshaler = &runtime.HTTPBodyMarshaler{
+	Marshaler: &runtime.JSONPb{
+		MarshalOptions: protojson.MarshalOptions{
+			EmitDefaultValues: true,
+		},
+		UnmarshalOptions: protojson.UnmarshalOptions{
+			DiscardUnknown: true,
+		},
+	},
+}
+
+// NewHandler returns an http.Handler translating REST/JSON requests to
+// UserService calls on conn. Authorization and x-totp-code headers are
+// forwarded as metadata so the gRPC interceptors see the same credentials,
+// along with request ids and W3C trace context headers.
+func NewHandler(ctx context.Context, conn *grpc.ClientConn) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(incomingHeader),
+		runtime.WithOutgoingHeaderMatcher(outgoingHeader),
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, marshaler),
+	)
+
+	if err := userv1.RegisterUserServiceHandler(ctx, mux, conn); err != nil {
+		return nil, err
+	}
+
+	if err := mux.HandlePath(http.MethodGet, OpenAPIPath, serveOpenAPI); err != nil {
+		return nil, err
+	}
+
+	return mux, nil
+}
+
+func incomingHeader(key string) (string, bool) {
+	switch textproto.CanonicalMIMEHeaderKey(key) {
+	case totpCodeHeader:
+		return "x-totp-code", true
+	case requestIdHeader, "Traceparent", "Tracestate":
+		return strings.ToLower(key), true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+func outgoingHeader(key string) (string, bool) {
+	switch key {
+	case retryAfterHeader:
+		return "Retry-After", true
+	case middleware.RequestIdHeader:
+		return requestIdHeader, true
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
+
+func serveOpenAPI(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write(api.OpenAPI)
+}
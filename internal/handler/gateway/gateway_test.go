@@ -0,0 +1,695 @@
+package gateway_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorobot-nz/test-task/api"
+	userv1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
+	"github.com/gorobot-nz/test-task/internal/handler/gateway"
+	usershandler "github.com/gorobot-nz/test-task/internal/handler/grpc/users"
+	apikeysrepository "github.com/gorobot-nz/test-task/internal/repository/apikeys"
+	tokensrepository "github.com/gorobot-nz/test-task/internal/repository/tokens"
+	usersrepository "github.com/gorobot-nz/test-task/internal/repository/users"
+	usersservice "github.com/gorobot-nz/test-task/internal/service/users"
+	"github.com/gorobot-nz/test-task/pkg/encryption"
+	"github.com/gorobot-nz/test-task/pkg/mailer"
+	"github.com/gorobot-nz/test-task/pkg/memlistener"
+	"github.com/gorobot-nz/test-task/pkg/middleware"
+	"github.com/gorobot-nz/test-task/pkg/password"
+	"github.com/gorobot-nz/test-task/pkg/storage"
+	"github.com/gorobot-nz/test-task/pkg/totp"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	adminUsername = "admin"
+	adminPassword = "Admin-Password1"
+)
+
+type testServer struct {
+	t      *testing.T
+	url    string
+	doc    *openapi3.T
+	router routers.Router
+	mail   *mailer.MemoryMailer
+
+	// called holds the operations a request was validated against.
+	called map[string]struct{}
+}
+
+// call is a request to the gateway and the status it must be answered with.
+type call struct {
+	method   string
+	path     string
+	body     any
+	username string
+	password string
+	totpCode string
+	apiKey   string
+	status   int
+}
+
+// newTestServer serves the gateway in front of a UserService backed by
+// in-memory stores, with a single admin user.
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	logger := zap.NewNop()
+	store := storage.NewStorage[*userv1.User]("users")
+	mail := mailer.NewMemoryMailer()
+
+	hasher, err := password.NewHasher(password.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secrets, err := encryption.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := hasher.Hash(adminPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Set(context.Background(), "admin-id", &userv1.User{
+		Id:            "admin-id",
+		Email:         "admin@example.com",
+		Username:      adminUsername,
+		Password:      hash,
+		Admin:         true,
+		EmailVerified: true,
+		CreateTime:    timestamppb.Now(),
+	})
+
+	service := usersservice.NewService(logger,
+		usersrepository.NewStorageRepository(logger, store),
+		tokensrepository.NewStorageRepository(logger, storage.NewStorage[*tokensrepository.Token]("tokens")),
+		apikeysrepository.NewStorageRepository(logger, storage.NewStorage[*apikeysrepository.Key]("api_keys")),
+		mail, hasher, secrets, usersservice.Config{TOTPIssuer: "test"},
+	)
+	lockouts := middleware.NewLockoutTracker(middleware.LockoutConfig{
+		AccountThreshold: 5,
+		PeerThreshold:    20,
+		BaseDuration:     time.Minute,
+		MaxDuration:      time.Hour,
+		ResetAfter:       15 * time.Minute,
+	}, func(middleware.LockEvent) {})
+
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(middleware.AuthMiddleware(middleware.CertIdentityNone, lockouts)),
+		grpc.StreamInterceptor(middleware.StreamAuthMiddleware(middleware.CertIdentityNone, lockouts)),
+	)
+	userv1.RegisterUserServiceServer(server, usershandler.NewHandler(logger, service, lockouts))
+
+	listener := memlistener.New()
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///gateway",
+		grpc.WithContextDialer(listener.DialContext),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	handler, err := gateway.NewHandler(context.Background(), conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpServer := httptest.NewServer(handler)
+	t.Cleanup(httpServer.Close)
+
+	doc, err := openapi3.NewLoader().LoadFromData(api.OpenAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testServer{
+		t:      t,
+		url:    httpServer.URL,
+		doc:    doc,
+		router: router,
+		mail:   mail,
+		called: make(map[string]struct{}),
+	}
+}
+
+// do sends c and checks the request, the status and the response body
+// against the operation the spec documents for the route. Server streams
+// are framed by the gateway as one {"result": ...} object per line, each
+// result is checked as the response.
+func (s *testServer) do(c call) []byte {
+	s.t.Helper()
+
+	var body []byte
+	if c.body != nil {
+		var err error
+		body, err = json.Marshal(c.body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+	}
+
+	req, err := http.NewRequest(c.method, s.url+c.path, bytes.NewReader(body))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if c.body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "apikey "+c.apiKey)
+	}
+	if c.totpCode != "" {
+		req.Header.Set("X-Totp-Code", c.totpCode)
+	}
+
+	route, pathParams, err := s.router.FindRoute(req)
+	if err != nil {
+		s.t.Fatalf("%s %s isn't documented: %v", c.method, c.path, err)
+	}
+	operationId := route.Operation.OperationID
+	s.called[operationId] = struct{}{}
+
+	input := &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: pathParams,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+			IncludeResponseStatus: true,
+		},
+	}
+	if err := openapi3filter.ValidateRequest(context.Background(), input); err != nil {
+		s.t.Fatalf("%s: invalid request: %v", operationId, err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.t.Fatalf("%s: %v", operationId, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatalf("%s: %v", operationId, err)
+	}
+
+	if resp.StatusCode != c.status {
+		s.t.Fatalf("%s: got status %d, want %d: %s", operationId, resp.StatusCode, c.status, respBody)
+	}
+
+	results := [][]byte{respBody}
+	if route.Operation.OperationID == "UserService_ExportUsers" && resp.StatusCode == http.StatusOK {
+		results = streamResults(s.t, respBody)
+	}
+
+	for _, result := range results {
+		err := openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 resp.StatusCode,
+			Header:                 resp.Header,
+			Body:                   io.NopCloser(bytes.NewReader(result)),
+			Options:                input.Options,
+		})
+		if err != nil {
+			s.t.Fatalf("%s: invalid response: %v: %s", operationId, err, result)
+		}
+	}
+
+	return respBody
+}
+
+func streamResults(t *testing.T, body []byte) [][]byte {
+	t.Helper()
+
+	var results [][]byte
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var message struct {
+			Result json.RawMessage `json:"result"`
+			Error  json.RawMessage `json:"error"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			t.Fatalf("Malformed stream message %s: %v", scanner.Bytes(), err)
+		}
+		if message.Error != nil {
+			t.Fatalf("Stream failed: %s", message.Error)
+		}
+		results = append(results, message.Result)
+	}
+
+	return results
+}
+
+// waitForToken returns the token from the last mail sent to to with
+// subject.
+func (s *testServer) waitForToken(to, subject string) string {
+	s.t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		messages := s.mail.Messages()
+		for i := len(messages) - 1; i >= 0; i-- {
+			if messages[i].To != to || messages[i].Subject != subject {
+				continue
+			}
+
+			_, rest, _ := strings.Cut(messages[i].Body, ": ")
+			return strings.Fields(rest)[0]
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.t.Fatalf("No %q mail to %s", subject, to)
+	return ""
+}
+
+func decode[T any](t *testing.T, body []byte) T {
+	t.Helper()
+
+	var v T
+	if err := json.Unmarshal(body, &v); err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
+
+func TestOperationsMatchSpec(t *testing.T) {
+	s := newTestServer(t)
+
+	admin := func(c call) call {
+		c.username, c.password = adminUsername, adminPassword
+		return c
+	}
+
+	aliceEmail := "alice@example.com"
+	alicePassword := "Alice-Password1"
+	alice := func(c call) call {
+		c.username, c.password = "alice", alicePassword
+		return c
+	}
+
+	created := decode[struct{ Id string }](t, s.do(admin(call{
+		method: http.MethodPost, path: "/v1/users", status: http.StatusOK,
+		body: map[string]any{"email": aliceEmail, "username": "alice", "password": alicePassword},
+	})))
+	aliceId := created.Id
+
+	s.do(call{
+		method: http.MethodPost, path: "/v1/users:verifyEmail", status: http.StatusOK,
+		body: map[string]any{"token": s.waitForToken(aliceEmail, "Verify your email")},
+	})
+
+	s.do(admin(call{method: http.MethodGet, path: "/v1/users?pageSize=10&orderBy=username", status: http.StatusOK}))
+	s.do(admin(call{method: http.MethodGet, path: "/v1/users/" + aliceId, status: http.StatusOK}))
+	s.do(admin(call{method: http.MethodGet, path: "/v1/users/unknown", status: http.StatusBadRequest}))
+	s.do(admin(call{method: http.MethodGet, path: "/v1/usernames/alice", status: http.StatusOK}))
+	s.do(admin(call{
+		method: http.MethodPatch, path: "/v1/users/" + aliceId, status: http.StatusOK,
+		body: map[string]any{"permissions": []string{"users.export_password_hashes"}, "updateMask": "permissions"},
+	}))
+
+	s.do(call{method: http.MethodGet, path: "/v1/me", status: http.StatusForbidden})
+	s.do(alice(call{method: http.MethodGet, path: "/v1/me", status: http.StatusOK}))
+
+	aliceEmail = "alice@example.org"
+	s.do(alice(call{
+		method: http.MethodPatch, path: "/v1/me", status: http.StatusOK,
+		body: map[string]any{"email": aliceEmail},
+	}))
+
+	s.do(alice(call{
+		method: http.MethodPost, path: "/v1/me:changePassword", status: http.StatusOK,
+		body: map[string]any{"currentPassword": alicePassword, "newPassword": "Alice-Password2"},
+	}))
+	alicePassword = "Alice-Password2"
+
+	enrolled := decode[struct{ Secret string }](t, s.do(alice(call{
+		method: http.MethodPost, path: "/v1/me/totp:enroll", status: http.StatusOK,
+		body: map[string]any{},
+	})))
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrolled.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	confirmed := decode[struct{ RecoveryCodes []string }](t, s.do(alice(call{
+		method: http.MethodPost, path: "/v1/me/totp:confirm", status: http.StatusOK,
+		body: map[string]any{"code": totp.Code(secret, time.Now())},
+	})))
+	if len(confirmed.RecoveryCodes) == 0 {
+		t.Fatalf("Got %d recovery codes", len(confirmed.RecoveryCodes))
+	}
+
+	s.do(alice(call{
+		method: http.MethodPost, path: "/v1/me/totp:disable", status: http.StatusOK,
+		totpCode: confirmed.RecoveryCodes[0],
+		body:     map[string]any{},
+	}))
+
+	key := decode[struct{ ApiKey struct{ Id string } }](t, s.do(admin(call{
+		method: http.MethodPost, path: "/v1/apiKeys", status: http.StatusOK,
+		body: map[string]any{"name": "ci", "userId": aliceId, "scopes": []string{middleware.ScopeUsersRead}},
+	})))
+	s.do(admin(call{method: http.MethodGet, path: "/v1/apiKeys?userId=" + aliceId, status: http.StatusOK}))
+	s.do(admin(call{
+		method: http.MethodPost, path: "/v1/apiKeys/" + key.ApiKey.Id + ":revoke", status: http.StatusOK,
+		body: map[string]any{},
+	}))
+
+	s.do(call{
+		method: http.MethodGet, path: "/v1/me", status: http.StatusForbidden,
+		username: "alice", password: "wrong",
+	})
+	s.do(admin(call{method: http.MethodGet, path: "/v1/lockouts", status: http.StatusOK}))
+	s.do(admin(call{
+		method: http.MethodPost, path: "/v1/lockouts:clear", status: http.StatusOK,
+		body: map[string]any{"kind": string(middleware.LockoutAccount), "subject": "alice"},
+	}))
+
+	batch := decode[struct{ Results []struct{ Id string } }](t, s.do(admin(call{
+		method: http.MethodPost, path: "/v1/users:batchCreate", status: http.StatusOK,
+		body: map[string]any{
+			"mode": "BATCH_MODE_BEST_EFFORT",
+			"requests": []map[string]any{
+				{"email": "bob@example.com", "username": "bob", "password": "Bob-Password1"},
+				{"email": "carol@example.com", "username": "carol", "password": "Carol-Password1"},
+			},
+		},
+	})))
+	if len(batch.Results) != 2 {
+		t.Fatalf("Got %d batch results", len(batch.Results))
+	}
+	bobId, carolId := batch.Results[0].Id, batch.Results[1].Id
+
+	s.do(admin(call{
+		method: http.MethodGet, path: "/v1/users:batchGet?ids=" + bobId + "&ids=" + carolId, status: http.StatusOK,
+	}))
+	s.do(admin(call{
+		method: http.MethodPost, path: "/v1/users:batchDelete", status: http.StatusOK,
+		body: map[string]any{"ids": []string{bobId}},
+	}))
+
+	var export bytes.Buffer
+	exported := s.do(admin(call{
+		method: http.MethodGet, path: "/v1/users:export?format=TRANSFER_FORMAT_JSONL", status: http.StatusOK,
+	}))
+	for _, result := range streamResults(t, exported) {
+		chunk := decode[struct{ Data []byte }](t, result)
+		export.Write(chunk.Data)
+	}
+
+	imported := decode[struct{ Total, Skipped int32 }](t, s.do(admin(call{
+		method: http.MethodPost, path: "/v1/users:import", status: http.StatusOK,
+		body: map[string]any{
+			"format": "TRANSFER_FORMAT_JSONL",
+			"mode":   "IMPORT_MODE_SKIP",
+			"data":   base64.StdEncoding.EncodeToString(export.Bytes()),
+		},
+	})))
+	if imported.Total == 0 || imported.Skipped != imported.Total {
+		t.Fatalf("Imported %d records, skipped %d, want all of the export skipped", imported.Total, imported.Skipped)
+	}
+
+	s.do(call{
+		method: http.MethodPost, path: "/v1/users:requestPasswordReset", status: http.StatusOK,
+		body: map[string]any{"email": aliceEmail},
+	})
+	s.do(call{
+		method: http.MethodPost, path: "/v1/users:resetPassword", status: http.StatusOK,
+		body: map[string]any{"token": s.waitForToken(aliceEmail, "Password reset"), "newPassword": "Alice-Password3"},
+	})
+
+	s.do(admin(call{method: http.MethodDelete, path: "/v1/users/" + carolId, status: http.StatusOK}))
+
+	for _, item := range s.doc.Paths.Map() {
+		for _, operation := range item.Operations() {
+			if _, ok := s.called[operation.OperationID]; !ok {
+				t.Errorf("%s wasn't called", operation.OperationID)
+			}
+		}
+	}
+}
+
+func TestErrorsMatchSpec(t *testing.T) {
+	s := newTestServer(t)
+
+	s.do(call{
+		method: http.MethodPost, path: "/v1/users", status: http.StatusForbidden,
+		body: map[string]any{"email": "mallory@example.com", "username": "mallory", "password": "Mallory-Password1"},
+	})
+	s.do(call{
+		method: http.MethodPost, path: "/v1/users:verifyEmail", status: http.StatusBadRequest,
+		body: map[string]any{"token": "unknown"},
+	})
+	s.do(call{
+		method: http.MethodPost, path: "/v1/users", status: http.StatusBadRequest,
+		username: adminUsername, password: adminPassword,
+		body: map[string]any{"email": "other@example.com", "username": adminUsername, "password": "Other-Password1"},
+	})
+	s.do(call{
+		method: http.MethodPost, path: "/v1/me:changePassword", status: http.StatusForbidden,
+		username: adminUsername, password: adminPassword,
+		body: map[string]any{"currentPassword": "Wrong-Password1", "newPassword": "Other-Password1"},
+	})
+}
+
+// TestUsersHideSecrets checks that reading users, which needs no
+// credentials, doesn't reveal password hashes or second factor secrets. The
+// gateway writes default values, so hidden fields may be present but empty.
+func TestUsersHideSecrets(t *testing.T) {
+	s := newTestServer(t)
+
+	hidden := func(user map[string]any) {
+		t.Helper()
+
+		for _, field := range []string{"password", "totpSecret"} {
+			if value, ok := user[field]; ok && value != "" {
+				t.Errorf("%s of %v is returned", field, user["username"])
+			}
+		}
+		if codes, ok := user["recoveryCodes"].([]any); ok && len(codes) > 0 {
+			t.Errorf("recoveryCodes of %v are returned", user["username"])
+		}
+	}
+
+	list := decode[struct{ Users []map[string]any }](t, s.do(call{
+		method: http.MethodGet, path: "/v1/users", status: http.StatusOK,
+	}))
+	if len(list.Users) == 0 {
+		t.Fatal("No users listed")
+	}
+	for _, user := range list.Users {
+		hidden(user)
+	}
+
+	got := decode[struct{ User map[string]any }](t, s.do(call{
+		method: http.MethodGet, path: "/v1/users/admin-id", status: http.StatusOK,
+	}))
+	hidden(got.User)
+}
+
+// TestImportKeepsUnsetFields checks that an upsert only changes what each
+// record sets, in both formats.
+func TestImportKeepsUnsetFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		data   string
+	}{
+		{"jsonl", "TRANSFER_FORMAT_JSONL", `{"id":"admin-id","email":"admin@example.com","username":"root"}` + "\n"},
+		{"csv", "TRANSFER_FORMAT_CSV", "id,email,username,admin,email_verified\nadmin-id,admin@example.com,root,,\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+
+			imported := decode[struct{ Updated int32 }](t, s.do(call{
+				method: http.MethodPost, path: "/v1/users:import", status: http.StatusOK,
+				username: adminUsername, password: adminPassword,
+				body: map[string]any{
+					"format": tt.format,
+					"mode":   "IMPORT_MODE_UPSERT",
+					"data":   base64.StdEncoding.EncodeToString([]byte(tt.data)),
+				},
+			}))
+			if imported.Updated != 1 {
+				t.Fatalf("Updated %d users, want 1", imported.Updated)
+			}
+
+			got := decode[struct {
+				User struct {
+					Username      string
+					Admin         bool
+					EmailVerified bool
+				}
+			}](t, s.do(call{method: http.MethodGet, path: "/v1/users/admin-id", status: http.StatusOK}))
+			if got.User.Username != "root" {
+				t.Errorf("Username is %q, want root", got.User.Username)
+			}
+			if !got.User.Admin || !got.User.EmailVerified {
+				t.Errorf("Admin is %t and email verified is %t, want both kept", got.User.Admin, got.User.EmailVerified)
+			}
+		})
+	}
+}
+
+// TestLockoutCountsWrongCredentials checks that only guessed credentials
+// count towards a lockout, not a login that's merely missing its second
+// factor.
+func TestLockoutCountsWrongCredentials(t *testing.T) {
+	s := newTestServer(t)
+
+	admin := func(c call) call {
+		c.username, c.password = adminUsername, adminPassword
+		return c
+	}
+
+	enrolled := decode[struct{ Secret string }](t, s.do(admin(call{
+		method: http.MethodPost, path: "/v1/me/totp:enroll", status: http.StatusOK,
+		body: map[string]any{},
+	})))
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrolled.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	confirmed := decode[struct{ RecoveryCodes []string }](t, s.do(admin(call{
+		method: http.MethodPost, path: "/v1/me/totp:confirm", status: http.StatusOK,
+		body: map[string]any{"code": totp.Code(secret, time.Now())},
+	})))
+	if len(confirmed.RecoveryCodes) < 2 {
+		t.Fatalf("Got %d recovery codes", len(confirmed.RecoveryCodes))
+	}
+
+	// The test server locks an account after 5 failures.
+	for i := 0; i < 6; i++ {
+		s.do(admin(call{method: http.MethodGet, path: "/v1/me", status: http.StatusForbidden}))
+	}
+	s.do(admin(call{
+		method: http.MethodGet, path: "/v1/me", status: http.StatusOK,
+		totpCode: confirmed.RecoveryCodes[0],
+	}))
+
+	for i := 0; i < 5; i++ {
+		s.do(admin(call{
+			method: http.MethodGet, path: "/v1/me", status: http.StatusForbidden,
+			totpCode: "000000",
+		}))
+	}
+	s.do(admin(call{
+		method: http.MethodGet, path: "/v1/me", status: http.StatusTooManyRequests,
+		totpCode: confirmed.RecoveryCodes[1],
+	}))
+}
+
+// TestApiKeysCantMakeAdmins checks that a users.write key, which manages
+// ordinary users, can't make or take over an admin.
+func TestApiKeysCantMakeAdmins(t *testing.T) {
+	s := newTestServer(t)
+
+	created := decode[struct{ Key string }](t, s.do(call{
+		method: http.MethodPost, path: "/v1/apiKeys", status: http.StatusOK,
+		username: adminUsername, password: adminPassword,
+		body: map[string]any{"name": "ci", "userId": "admin-id", "scopes": []string{middleware.ScopeUsersWrite}},
+	}))
+	key := func(c call) call {
+		c.apiKey = created.Key
+		return c
+	}
+
+	user := decode[struct{ Id string }](t, s.do(key(call{
+		method: http.MethodPost, path: "/v1/users", status: http.StatusOK,
+		body: map[string]any{"email": "bob@example.com", "username": "bob", "password": "Bob-Password1"},
+	})))
+	s.do(key(call{
+		method: http.MethodPatch, path: "/v1/users/" + user.Id, status: http.StatusOK,
+		body: map[string]any{"username": "robert"},
+	}))
+
+	tests := []struct {
+		name string
+		call call
+	}{
+		{"create admin", call{
+			method: http.MethodPost, path: "/v1/users",
+			body: map[string]any{"email": "mallory@example.com", "username": "mallory", "password": "Mallory-Password1", "admin": true},
+		}},
+		{"batch create admin", call{
+			method: http.MethodPost, path: "/v1/users:batchCreate",
+			body: map[string]any{"requests": []map[string]any{
+				{"email": "mallory@example.com", "username": "mallory", "password": "Mallory-Password1", "admin": true},
+			}},
+		}},
+		{"grant admin", call{
+			method: http.MethodPatch, path: "/v1/users/" + user.Id,
+			body: map[string]any{"admin": true},
+		}},
+		{"set password", call{
+			method: http.MethodPatch, path: "/v1/users/" + user.Id,
+			body: map[string]any{"password": "Mallory-Password1"},
+		}},
+		{"grant permissions", call{
+			method: http.MethodPatch, path: "/v1/users/" + user.Id,
+			body: map[string]any{"permissions": []string{"users.export_password_hashes"}, "updateMask": "permissions"},
+		}},
+		{"change an admin", call{
+			method: http.MethodPatch, path: "/v1/users/admin-id",
+			body: map[string]any{"email": "mallory@example.com"},
+		}},
+		{"import", call{
+			method: http.MethodPost, path: "/v1/users:import",
+			body: map[string]any{
+				"format": "TRANSFER_FORMAT_JSONL",
+				"data":   base64.StdEncoding.EncodeToString([]byte(`{"email":"mallory@example.com","username":"mallory","password":"Mallory-Password1","admin":true}` + "\n")),
+			},
+		}},
+	}
+
+	for _, tt := range tests {
+		c := key(tt.call)
+		c.status = http.StatusForbidden
+		t.Log(tt.name)
+		s.do(c)
+	}
+}
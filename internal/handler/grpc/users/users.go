@@ -1,63 +1,277 @@
 package users
 
 import (
+	"bufio"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/gorobot-nz/test-task/internal/repository/apikeys"
+	usersservice "github.com/gorobot-nz/test-task/internal/service/users"
+	applogger "github.com/gorobot-nz/test-task/pkg/logger"
+	"github.com/gorobot-nz/test-task/pkg/metrics"
 	"github.com/gorobot-nz/test-task/pkg/middleware"
-	"golang.org/x/crypto/bcrypt"
 
 	userv1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type Service interface {
 	NewUser(ctx context.Context, user *userv1.User) (string, error)
-	GetUsers(ctx context.Context, page, limit int32) ([]*userv1.User, error)
+	GetUsers(ctx context.Context, query usersservice.UsersQuery) (*usersservice.UsersPage, error)
 	GetUserById(ctx context.Context, id string) (*userv1.User, error)
 	GetUserByUsername(ctx context.Context, username string) (*userv1.User, error)
-	UpdateUser(ctx context.Context, user *userv1.User) (*userv1.User, error)
+	UpdateUser(ctx context.Context, user *userv1.User, paths []string) (*userv1.User, error)
 	DeleteUser(ctx context.Context, id string) error
+	Authenticate(ctx context.Context, username, password, passcode string) (*userv1.User, error)
+	UpdateMe(ctx context.Context, id string, email, username *string) (*userv1.User, error)
+	ChangePassword(ctx context.Context, id, currentPassword, newPassword string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	VerifyEmail(ctx context.Context, token string) error
+	EnrollTOTP(ctx context.Context, id string) (string, string, error)
+	ConfirmTOTP(ctx context.Context, id, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, id, code string, verified bool) error
+	CreateApiKey(ctx context.Context, name, userId string, scopes []string, expiresAt *time.Time) (*apikeys.Key, string, error)
+	ListApiKeys(ctx context.Context, userId string) ([]*apikeys.Key, error)
+	RevokeApiKey(ctx context.Context, id string) error
+	AuthenticateApiKey(ctx context.Context, key string) (*userv1.User, []string, error)
+	AuthenticateCertificate(ctx context.Context, principal string) (*userv1.User, error)
+	BatchCreateUsers(ctx context.Context, users []*userv1.User, allOrNothing bool) ([]usersservice.BatchResult, error)
+	BatchGetUsers(ctx context.Context, ids []string, allOrNothing bool) ([]usersservice.BatchResult, error)
+	BatchDeleteUsers(ctx context.Context, actorId string, ids []string, allOrNothing bool) ([]usersservice.BatchResult, error)
+	ExportUsers(ctx context.Context, w io.Writer, format usersservice.Format, filter string, includeHashes bool) error
+	ImportUsers(ctx context.Context, r io.Reader, options usersservice.ImportOptions) (*usersservice.ImportSummary, error)
+}
+
+type Lockouts interface {
+	List() []middleware.Lockout
+	Clear(kind middleware.LockoutKind, subject string) bool
 }
 
 type Handler struct {
 	userv1.UnimplementedUserServiceServer
 
-	service Service
+	service  Service
+	lockouts Lockouts
 
 	logger *zap.Logger
 }
 
-func NewHandler(logger *zap.Logger, service Service) *Handler {
+func NewHandler(logger *zap.Logger, service Service, lockouts Lockouts) *Handler {
 	return &Handler{
-		logger:  logger,
-		service: service,
+		logger:   logger,
+		service:  service,
+		lockouts: lockouts,
 	}
 }
 
-func (h *Handler) NewUser(ctx context.Context, req *userv1.NewUserRequest) (*userv1.NewUserResponse, error) {
-	log := h.logger.Named("NewUser")
+func authFailureReason(err error) string {
+	switch {
+	case errors.Is(err, usersservice.ErrUserNotFound):
+		return "unknown_user"
+	case errors.Is(err, usersservice.ErrWrongPassword):
+		return "wrong_password"
+	case errors.Is(err, usersservice.ErrEmailNotVerified):
+		return "email_not_verified"
+	case errors.Is(err, usersservice.ErrSecondFactorRequired):
+		return "second_factor_required"
+	case errors.Is(err, usersservice.ErrWrongSecondFactor):
+		return "wrong_second_factor"
+	case errors.Is(err, usersservice.ErrWrongApiKey):
+		return "wrong_api_key"
+	case errors.Is(err, usersservice.ErrApiKeyRevoked):
+		return "api_key_revoked"
+	case errors.Is(err, usersservice.ErrApiKeyExpired):
+		return "api_key_expired"
+	default:
+		return "other"
+	}
+}
+
+// authenticate verifies the caller's credentials, charges their rate limit
+// bucket and records who they are on the RPC span and the request logger.
+func (h *Handler) authenticate(ctx context.Context) (*userv1.User, error) {
+	user, err := h.verifyCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := middleware.Authenticated(ctx, user.GetId()); err != nil {
+		return nil, err
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("enduser.id", user.GetId()))
+	applogger.AddFields(ctx, zap.String("user_id", user.GetId()))
+
+	return user, nil
+}
+
+// wrongCredentials reports whether err means the credentials were guessed
+// wrong, which counts towards a lockout. Right credentials that can't be
+// used yet, like those of an unverified email or without the second factor,
+// don't.
+func wrongCredentials(err error) bool {
+	return errors.Is(err, usersservice.ErrWrongPassword) ||
+		errors.Is(err, usersservice.ErrUserNotFound) ||
+		errors.Is(err, usersservice.ErrWrongSecondFactor) ||
+		errors.Is(err, usersservice.ErrWrongApiKey)
+}
+
+// authError is what a failed authenticate returns to the caller. Callers
+// over their rate limit are told so, everything else is denied without
+// saying why.
+func authError(err error) error {
+	if status.Code(err) == codes.ResourceExhausted {
+		return err
+	}
+	return status.Error(codes.PermissionDenied, "Permission denied")
+}
+
+// verifyCredentials checks an API key, a client certificate principal or a
+// password. Only password logins ask for the TOTP second factor: keys and
+// certificates are credentials the client holds rather than knows, so they
+// stand in for it, for admins too. API keys can't manage credentials at
+// all, see middleware.ScopeAllows.
+func (h *Handler) verifyCredentials(ctx context.Context) (*userv1.User, error) {
+	if key, ok := ctx.Value(middleware.ApiKey).(string); ok {
+		user, scopes, err := h.service.AuthenticateApiKey(ctx, key)
+		if err != nil {
+			metrics.AuthFailures.WithLabelValues(authFailureReason(err)).Inc()
+			if wrongCredentials(err) {
+				middleware.AuthFailed(ctx)
+			}
+			return nil, err
+		}
+		middleware.AuthSucceeded(ctx)
+
+		method, _ := grpc.Method(ctx)
+		if !middleware.ScopeAllows(scopes, method) {
+			metrics.AuthFailures.WithLabelValues("api_key_scope").Inc()
+			return nil, errors.New("api key scope doesn't allow method")
+		}
 
-	log.Debug("Request received", zap.Any("req", req))
+		return user, nil
+	}
+
+	if principal, ok := ctx.Value(middleware.CertPrincipal).(string); ok {
+		user, err := h.service.AuthenticateCertificate(ctx, principal)
+		if err != nil {
+			metrics.AuthFailures.WithLabelValues(authFailureReason(err)).Inc()
+			return nil, err
+		}
+		return user, nil
+	}
 
-	username := ctx.Value(middleware.Username).(string)
-	password := ctx.Value(middleware.Password).(string)
+	username, _ := ctx.Value(middleware.Username).(string)
+	password, _ := ctx.Value(middleware.Password).(string)
+	passcode, _ := ctx.Value(middleware.TOTPCode).(string)
 
-	u, err := h.service.GetUserByUsername(ctx, username)
+	user, err := h.service.Authenticate(ctx, username, password, passcode)
 	if err != nil {
-		log.Error("Failed to get admin user", zap.Error(err))
-		return nil, status.Error(codes.PermissionDenied, "Permission denied")
+		metrics.AuthFailures.WithLabelValues(authFailureReason(err)).Inc()
+		if wrongCredentials(err) {
+			middleware.AuthFailed(ctx)
+		}
+		return nil, err
+	}
+	middleware.AuthSucceeded(ctx)
+
+	return user, nil
+}
+
+// apiKeyCaller reports whether the call authenticates with an API key.
+func apiKeyCaller(ctx context.Context) bool {
+	_, ok := ctx.Value(middleware.ApiKey).(string)
+	return ok
+}
+
+// apiKeyMayUpdate reports whether an API key may update the user with id.
+// Keys manage ordinary users only: they can't set passwords, grant admin or
+// permissions, or change an admin, whose email would let them reset the
+// admin's password.
+func (h *Handler) apiKeyMayUpdate(ctx context.Context, id string, paths []string) bool {
+	for _, path := range paths {
+		if path == usersservice.FieldPassword || path == usersservice.FieldAdmin || path == usersservice.FieldPermissions {
+			return false
+		}
+	}
+
+	target, err := h.service.GetUserById(ctx, id)
+	return err == nil && !target.GetAdmin()
+}
+
+// passedSecondFactor reports whether authenticating the call already
+// checked a TOTP or recovery code for user, which password logins do.
+func passedSecondFactor(ctx context.Context, user *userv1.User) bool {
+	if apiKeyCaller(ctx) {
+		return false
+	}
+	if _, ok := ctx.Value(middleware.CertPrincipal).(string); ok {
+		return false
+	}
+	return user.GetTotpEnabled()
+}
+
+func apiKeyToProto(key *apikeys.Key) *userv1.ApiKey {
+	result := &userv1.ApiKey{
+		Id:         key.Id,
+		Name:       key.Name,
+		UserId:     key.UserId,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		CreateTime: timestamppb.New(key.CreatedAt),
+	}
+
+	if key.ExpiresAt != nil {
+		result.ExpireTime = timestamppb.New(*key.ExpiresAt)
+	}
+
+	if key.RevokedAt != nil {
+		result.RevokeTime = timestamppb.New(*key.RevokedAt)
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(u.GetPassword()), []byte(password))
+	return result
+}
+
+func publicUser(user *userv1.User) *userv1.User {
+	result := proto.Clone(user).(*userv1.User)
+	result.Password = ""
+	result.TotpSecret = ""
+	result.TotpLastStep = 0
+	result.RecoveryCodes = nil
+	return result
+}
+
+func (h *Handler) NewUser(ctx context.Context, req *userv1.NewUserRequest) (*userv1.NewUserResponse, error) {
+	log := applogger.FromContext(ctx, h.logger).Named("NewUser")
+
+	log.Debug("Request received", applogger.Proto("req", req))
+
+	u, err := h.authenticate(ctx)
 	if err != nil {
-		log.Error("Failed to verify password admin user", zap.Error(err))
-		return nil, status.Error(codes.PermissionDenied, "Permission denied")
+		log.Error("Failed to authenticate user", zap.Error(err))
+		return nil, authError(err)
 	}
 
 	if !u.GetAdmin() {
-		log.Error("Failed to verify admin status", zap.Error(err))
+		log.Error("Failed to verify admin status")
+		return nil, status.Error(codes.PermissionDenied, "Permission denied")
+	}
+
+	if req.GetAdmin() && apiKeyCaller(ctx) {
+		log.Error("Admin creation not allowed with an API key")
 		return nil, status.Error(codes.PermissionDenied, "Permission denied")
 	}
 
@@ -80,33 +294,49 @@ func (h *Handler) NewUser(ctx context.Context, req *userv1.NewUserRequest) (*use
 }
 
 func (h *Handler) GetUsers(ctx context.Context, req *userv1.GetUsersRequest) (*userv1.GetUsersResponse, error) {
-	log := h.logger.Named("GetUsers")
-
-	log.Debug("Request received", zap.Any("req", req))
+	log := applogger.FromContext(ctx, h.logger).Named("GetUsers")
 
-	var page, limit int32 = -1, -1
+	log.Debug("Request received", applogger.Proto("req", req))
 
-	if req.Page != nil {
-		page = req.GetPage()
+	if len(req.GetFilter()) > maxFilterLength {
+		log.Error("Filter too long", zap.Int("length", len(req.GetFilter())))
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Filter is longer than %d bytes", maxFilterLength))
 	}
 
-	if req.Limit != nil {
-		limit = req.GetLimit()
+	page, err := h.service.GetUsers(ctx, usersservice.UsersQuery{
+		Filter:    req.GetFilter(),
+		OrderBy:   req.GetOrderBy(),
+		Search:    req.GetSearch(),
+		PageSize:  req.GetPageSize(),
+		PageToken: req.GetPageToken(),
+		Page:      req.Page,
+		Limit:     req.Limit,
+	})
+	if errors.Is(err, usersservice.ErrInvalidQuery) {
+		log.Error("Invalid query", zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
-
-	users, err := h.service.GetUsers(ctx, page, limit)
 	if err != nil {
 		log.Error("Failed to get users", zap.Error(err))
 		return nil, status.Error(codes.Internal, "Failed to get users")
 	}
 
-	return &userv1.GetUsersResponse{Users: users}, nil
+	result := make([]*userv1.User, len(page.Users))
+	for index, val := range page.Users {
+		result[index] = publicUser(val)
+	}
+
+	return &userv1.GetUsersResponse{
+		Users:         result,
+		NextPageToken: page.NextPageToken,
+		TotalSize:     page.TotalSize,
+	}, nil
 }
 
 func (h *Handler) GetUserById(ctx context.Context, req *userv1.GetUserByIdRequest) (*userv1.GetUserByIdResponse, error) {
-	log := h.logger.Named("GetUserById")
+	log := applogger.FromContext(ctx, h.logger).Named("GetUserById")
 
-	log.Debug("Request received", zap.Any("req", req))
+	log.Debug("Request received", applogger.Proto("req", req))
 
 	user, err := h.service.GetUserById(ctx, req.GetId())
 	if err != nil {
@@ -114,13 +344,13 @@ func (h *Handler) GetUserById(ctx context.Context, req *userv1.GetUserByIdReques
 		return nil, status.Error(codes.InvalidArgument, "Failed to get user")
 	}
 
-	return &userv1.GetUserByIdResponse{User: user}, nil
+	return &userv1.GetUserByIdResponse{User: publicUser(user)}, nil
 }
 
 func (h *Handler) GetUserByUsername(ctx context.Context, req *userv1.GetUserByUsernameRequest) (*userv1.GetUserByUsernameResponse, error) {
-	log := h.logger.Named("GetUserByUsername")
+	log := applogger.FromContext(ctx, h.logger).Named("GetUserByUsername")
 
-	log.Debug("Request received", zap.Any("req", req))
+	log.Debug("Request received", applogger.Proto("req", req))
 
 	user, err := h.service.GetUserByUsername(ctx, req.GetUsername())
 	if err != nil {
@@ -128,86 +358,710 @@ func (h *Handler) GetUserByUsername(ctx context.Context, req *userv1.GetUserByUs
 		return nil, status.Error(codes.InvalidArgument, "Failed to get user")
 	}
 
-	return &userv1.GetUserByUsernameResponse{User: user}, nil
+	return &userv1.GetUserByUsernameResponse{User: publicUser(user)}, nil
 }
 
 func (h *Handler) UpdateUser(ctx context.Context, req *userv1.UpdateUserRequest) (*userv1.UpdateUserResponse, error) {
-	log := h.logger.Named("UpdateUser")
+	log := applogger.FromContext(ctx, h.logger).Named("UpdateUser")
 
-	log.Debug("Request received", zap.Any("req", req))
+	log.Debug("Request received", applogger.Proto("req", req))
 
-	username := ctx.Value(middleware.Username).(string)
-	password := ctx.Value(middleware.Password).(string)
-
-	u, err := h.service.GetUserByUsername(ctx, username)
+	u, err := h.authenticate(ctx)
 	if err != nil {
-		log.Error("Failed to get admin user", zap.Error(err))
+		log.Error("Failed to authenticate user", zap.Error(err))
+		return nil, authError(err)
+	}
+
+	if !u.GetAdmin() {
+		log.Error("Failed to verify admin status")
 		return nil, status.Error(codes.PermissionDenied, "Permission denied")
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(u.GetPassword()), []byte(password))
-	if err != nil {
-		log.Error("Failed to verify password admin user", zap.Error(err))
+	user := &userv1.User{
+		Id:          req.GetId(),
+		Email:       req.GetEmail(),
+		Username:    req.GetUsername(),
+		Password:    req.GetPassword(),
+		Admin:       req.GetAdmin(),
+		Permissions: req.GetPermissions(),
+	}
+
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		paths = updatePaths(req)
+	}
+
+	if apiKeyCaller(ctx) && !h.apiKeyMayUpdate(ctx, req.GetId(), paths) {
+		log.Error("Update not allowed with an API key", zap.Strings("paths", paths))
 		return nil, status.Error(codes.PermissionDenied, "Permission denied")
 	}
 
+	user, err = h.service.UpdateUser(ctx, user, paths)
+	if errors.Is(err, usersservice.ErrInvalidUpdateMask) {
+		log.Error("Invalid update mask", zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, usersservice.ErrDuplicateUser) {
+		log.Error("Username or email already taken", zap.Error(err))
+		return nil, status.Error(codes.AlreadyExists, "Username or email already taken")
+	}
+	if err != nil {
+		log.Error("Failed to update user", zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, "Failed to update user")
+	}
+
+	return &userv1.UpdateUserResponse{User: publicUser(user)}, nil
+}
+
+// updatePaths lists the fields set on a request that has no update mask.
+func updatePaths(req *userv1.UpdateUserRequest) []string {
+	var paths []string
+	if req.Email != nil {
+		paths = append(paths, usersservice.FieldEmail)
+	}
+	if req.Username != nil {
+		paths = append(paths, usersservice.FieldUsername)
+	}
+	if req.Password != nil {
+		paths = append(paths, usersservice.FieldPassword)
+	}
+	if req.Admin != nil {
+		paths = append(paths, usersservice.FieldAdmin)
+	}
+	return paths
+}
+
+func (h *Handler) DeleteUser(ctx context.Context, req *userv1.DeleteUserRequest) (*userv1.DeleteUserResponse, error) {
+	log := applogger.FromContext(ctx, h.logger).Named("DeleteUser")
+
+	log.Debug("Request received", applogger.Proto("req", req))
+
+	u, err := h.authenticate(ctx)
+	if err != nil {
+		log.Error("Failed to authenticate user", zap.Error(err))
+		return nil, authError(err)
+	}
+
 	if !u.GetAdmin() {
-		log.Error("Failed to verify admin status", zap.Error(err))
+		log.Error("Failed to verify admin status")
 		return nil, status.Error(codes.PermissionDenied, "Permission denied")
 	}
 
-	user := &userv1.User{
-		Id:       req.GetId(),
-		Email:    req.GetEmail(),
-		Username: req.GetUsername(),
-		Password: req.GetPassword(),
-		Admin:    req.GetAdmin(),
+	if u.GetId() == req.GetId() {
+		log.Error("Cannot delete yourself")
+		return nil, status.Error(codes.Aborted, "You can't delete yourself")
+	}
+
+	err = h.service.DeleteUser(ctx, req.GetId())
+	if err != nil {
+		log.Error("Failed to delete user", zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, "Failed to delete user")
+	}
+
+	return &userv1.DeleteUserResponse{}, nil
+}
+
+func (h *Handler) GetMe(ctx context.Context, req *userv1.GetMeRequest) (*userv1.GetMeResponse, error) {
+	log := applogger.FromContext(ctx, h.logger).Named("GetMe")
+
+	log.Debug("Request received", applogger.Proto("req", req))
+
+	u, err := h.authenticate(ctx)
+	if err != nil {
+		log.Error("Failed to authenticate user", zap.Error(err))
+		return nil, authError(err)
+	}
+
+	return &userv1.GetMeResponse{User: publicUser(u)}, nil
+}
+
+func (h *Handler) UpdateMe(ctx context.Context, req *userv1.UpdateMeRequest) (*userv1.UpdateMeResponse, error) {
+	log := applogger.FromContext(ctx, h.logger).Named("UpdateMe")
+
+	log.Debug("Request received", applogger.Proto("req", req))
+
+	u, err := h.authenticate(ctx)
+	if err != nil {
+		log.Error("Failed to authenticate user", zap.Error(err))
+		return nil, authError(err)
 	}
 
-	user, err = h.service.UpdateUser(ctx, user)
+	user, err := h.service.UpdateMe(ctx, u.GetId(), req.Email, req.Username)
+	if errors.Is(err, usersservice.ErrDuplicateUser) {
+		log.Error("Username or email already taken", zap.Error(err))
+		return nil, status.Error(codes.AlreadyExists, "Username or email already taken")
+	}
 	if err != nil {
 		log.Error("Failed to update user", zap.Error(err))
 		return nil, status.Error(codes.InvalidArgument, "Failed to update user")
 	}
 
-	return &userv1.UpdateUserResponse{User: user}, nil
+	return &userv1.UpdateMeResponse{User: publicUser(user)}, nil
 }
 
-func (h *Handler) DeleteUser(ctx context.Context, req *userv1.DeleteUserRequest) (*userv1.DeleteUserResponse, error) {
-	log := h.logger.Named("UpdateUser")
+func (h *Handler) ChangePassword(ctx context.Context, req *userv1.ChangePasswordRequest) (*userv1.ChangePasswordResponse, error) {
+	log := applogger.FromContext(ctx, h.logger).Named("ChangePassword")
 
-	log.Debug("Request received", zap.Any("req", req))
+	log.Debug("Request received", applogger.Proto("req", req))
 
-	username := ctx.Value(middleware.Username).(string)
-	password := ctx.Value(middleware.Password).(string)
+	u, err := h.authenticate(ctx)
+	if err != nil {
+		log.Error("Failed to authenticate user", zap.Error(err))
+		return nil, authError(err)
+	}
 
-	u, err := h.service.GetUserByUsername(ctx, username)
+	err = h.service.ChangePassword(ctx, u.GetId(), req.GetCurrentPassword(), req.GetNewPassword())
+	if errors.Is(err, usersservice.ErrWrongPassword) {
+		log.Error("Wrong current password", zap.Error(err))
+		return nil, status.Error(codes.PermissionDenied, "Permission denied")
+	}
 	if err != nil {
-		log.Error("Failed to get admin user", zap.Error(err))
-		return nil, err
+		log.Error("Failed to change password", zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, "Failed to change password")
+	}
+
+	return &userv1.ChangePasswordResponse{}, nil
+}
+
+func (h *Handler) RequestPasswordReset(ctx context.Context, req *userv1.RequestPasswordResetRequest) (*userv1.RequestPasswordResetResponse, error) {
+	log := applogger.FromContext(ctx, h.logger).Named("RequestPasswordReset")
+
+	log.Debug("Request received", applogger.Proto("req", req))
+
+	err := h.service.RequestPasswordReset(ctx, req.GetEmail())
+	if errors.Is(err, usersservice.ErrMailDisabled) {
+		log.Error("Password reset requested without a mailer", zap.Error(err))
+		return nil, status.Error(codes.Unimplemented, "Password reset is not available")
+	}
+	if errors.Is(err, usersservice.ErrRateLimited) {
+		log.Error("Too many reset requests", zap.Error(err))
+		return nil, status.Error(codes.ResourceExhausted, "Too many requests")
+	}
+	if err != nil {
+		log.Error("Failed to request password reset", zap.Error(err))
+		return nil, status.Error(codes.Internal, "Failed to request password reset")
+	}
+
+	return &userv1.RequestPasswordResetResponse{}, nil
+}
+
+func (h *Handler) ResetPassword(ctx context.Context, req *userv1.ResetPasswordRequest) (*userv1.ResetPasswordResponse, error) {
+	log := applogger.FromContext(ctx, h.logger).Named("ResetPassword")
+
+	log.Debug("Request received", applogger.Proto("req", req))
+
+	err := h.service.ResetPassword(ctx, req.GetToken(), req.GetNewPassword())
+	if err != nil {
+		log.Error("Failed to reset password", zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, "Failed to reset password")
+	}
+
+	return &userv1.ResetPasswordResponse{}, nil
+}
+
+func (h *Handler) VerifyEmail(ctx context.Context, req *userv1.VerifyEmailRequest) (*userv1.VerifyEmailResponse, error) {
+	log := applogger.FromContext(ctx, h.logger).Named("VerifyEmail")
+
+	log.Debug("Request received", applogger.Proto("req", req))
+
+	err := h.service.VerifyEmail(ctx, req.GetToken())
+	if err != nil {
+		log.Error("Failed to verify email", zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, "Failed to verify email")
+	}
+
+	return &userv1.VerifyEmailResponse{}, nil
+}
+
+func (h *Handler) EnrollTOTP(ctx context.Context, req *userv1.EnrollTOTPRequest) (*userv1.EnrollTOTPResponse, error) {
+	log := applogger.FromContext(ctx, h.logger).Named("EnrollTOTP")
+
+	log.Debug("Request received", applogger.Proto("req", req))
+
+	u, err := h.authenticate(ctx)
+	if err != nil {
+		log.Error("Failed to authenticate user", zap.Error(err))
+		return nil, authError(err)
+	}
+
+	secret, uri, err := h.service.EnrollTOTP(ctx, u.GetId())
+	if err != nil {
+		log.Error("Failed to enroll totp", zap.Error(err))
+		return nil, status.Error(codes.FailedPrecondition, "Failed to enroll totp")
+	}
+
+	return &userv1.EnrollTOTPResponse{Secret: secret, Uri: uri}, nil
+}
+
+func (h *Handler) ConfirmTOTP(ctx context.Context, req *userv1.ConfirmTOTPRequest) (*userv1.ConfirmTOTPResponse, error) {
+	log := applogger.FromContext(ctx, h.logger).Named("ConfirmTOTP")
+
+	log.Debug("Request received", applogger.Proto("req", req))
+
+	u, err := h.authenticate(ctx)
+	if err != nil {
+		log.Error("Failed to authenticate user", zap.Error(err))
+		return nil, authError(err)
+	}
+
+	recoveryCodes, err := h.service.ConfirmTOTP(ctx, u.GetId(), req.GetCode())
+	if err != nil {
+		log.Error("Failed to confirm totp", zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, "Failed to confirm totp")
+	}
+
+	return &userv1.ConfirmTOTPResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+func (h *Handler) DisableTOTP(ctx context.Context, req *userv1.DisableTOTPRequest) (*userv1.DisableTOTPResponse, error) {
+	log := applogger.FromContext(ctx, h.logger).Named("DisableTOTP")
+
+	log.Debug("Request received", applogger.Proto("req", req))
+
+	u, err := h.authenticate(ctx)
+	if err != nil {
+		log.Error("Failed to authenticate user", zap.Error(err))
+		return nil, authError(err)
+	}
+
+	err = h.service.DisableTOTP(ctx, u.GetId(), req.GetCode(), passedSecondFactor(ctx, u))
+	if err != nil {
+		log.Error("Failed to disable totp", zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, "Failed to disable totp")
+	}
+
+	return &userv1.DisableTOTPResponse{}, nil
+}
+
+func (h *Handler) CreateApiKey(ctx context.Context, req *userv1.CreateApiKeyRequest) (*userv1.CreateApiKeyResponse, error) {
+	log := applogger.FromContext(ctx, h.logger).Named("CreateApiKey")
+
+	log.Debug("Request received", applogger.Proto("req", req))
+
+	u, err := h.authenticate(ctx)
+	if err != nil {
+		log.Error("Failed to authenticate user", zap.Error(err))
+		return nil, authError(err)
+	}
+
+	if !u.GetAdmin() {
+		log.Error("Failed to verify admin status")
+		return nil, status.Error(codes.PermissionDenied, "Permission denied")
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(u.GetPassword()), []byte(password))
+	var expiresAt *time.Time
+	if req.ExpireTime != nil {
+		t := req.GetExpireTime().AsTime()
+		expiresAt = &t
+	}
+
+	key, secret, err := h.service.CreateApiKey(ctx, req.GetName(), req.GetUserId(), req.GetScopes(), expiresAt)
 	if err != nil {
-		log.Error("Failed to verify password admin user", zap.Error(err))
+		log.Error("Failed to create api key", zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, "Failed to create api key")
+	}
+
+	return &userv1.CreateApiKeyResponse{ApiKey: apiKeyToProto(key), Key: secret}, nil
+}
+
+func (h *Handler) ListApiKeys(ctx context.Context, req *userv1.ListApiKeysRequest) (*userv1.ListApiKeysResponse, error) {
+	log := applogger.FromContext(ctx, h.logger).Named("ListApiKeys")
+
+	log.Debug("Request received", applogger.Proto("req", req))
+
+	u, err := h.authenticate(ctx)
+	if err != nil {
+		log.Error("Failed to authenticate user", zap.Error(err))
+		return nil, authError(err)
+	}
+
+	if !u.GetAdmin() {
+		log.Error("Failed to verify admin status")
 		return nil, status.Error(codes.PermissionDenied, "Permission denied")
 	}
 
+	keys, err := h.service.ListApiKeys(ctx, req.GetUserId())
+	if err != nil {
+		log.Error("Failed to list api keys", zap.Error(err))
+		return nil, status.Error(codes.Internal, "Failed to list api keys")
+	}
+
+	result := make([]*userv1.ApiKey, len(keys))
+	for index, val := range keys {
+		result[index] = apiKeyToProto(val)
+	}
+
+	return &userv1.ListApiKeysResponse{ApiKeys: result}, nil
+}
+
+func (h *Handler) RevokeApiKey(ctx context.Context, req *userv1.RevokeApiKeyRequest) (*userv1.RevokeApiKeyResponse, error) {
+	log := applogger.FromContext(ctx, h.logger).Named("RevokeApiKey")
+
+	log.Debug("Request received", applogger.Proto("req", req))
+
+	u, err := h.authenticate(ctx)
+	if err != nil {
+		log.Error("Failed to authenticate user", zap.Error(err))
+		return nil, authError(err)
+	}
+
 	if !u.GetAdmin() {
-		log.Error("Failed to verify admin status", zap.Error(err))
+		log.Error("Failed to verify admin status")
 		return nil, status.Error(codes.PermissionDenied, "Permission denied")
 	}
 
-	if u.GetId() == req.GetId() {
-		log.Error("Cannot delete yourself", zap.Error(err))
-		return nil, status.Error(codes.Aborted, "You can't delete yourself")
+	err = h.service.RevokeApiKey(ctx, req.GetId())
+	if err != nil {
+		log.Error("Failed to revoke api key", zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, "Failed to revoke api key")
 	}
 
-	err = h.service.DeleteUser(ctx, req.GetId())
+	return &userv1.RevokeApiKeyResponse{}, nil
+}
+
+func (h *Handler) ListLockouts(ctx context.Context, req *userv1.ListLockoutsRequest) (*userv1.ListLockoutsResponse, error) {
+	log := applogger.FromContext(ctx, h.logger).Named("ListLockouts")
+
+	log.Debug("Request received", applogger.Proto("req", req))
+
+	u, err := h.authenticate(ctx)
 	if err != nil {
-		log.Error("Failed to delete user", zap.Error(err))
-		return nil, status.Error(codes.InvalidArgument, "Failed to delete user")
+		log.Error("Failed to authenticate user", zap.Error(err))
+		return nil, authError(err)
 	}
 
-	return &userv1.DeleteUserResponse{}, nil
+	if !u.GetAdmin() {
+		log.Error("Failed to verify admin status")
+		return nil, status.Error(codes.PermissionDenied, "Permission denied")
+	}
+
+	list := h.lockouts.List()
+
+	result := make([]*userv1.Lockout, len(list))
+	for index, val := range list {
+		result[index] = &userv1.Lockout{
+			Kind:            string(val.Kind),
+			Subject:         val.Subject,
+			Failures:        int32(val.Failures),
+			LastFailureTime: timestamppb.New(val.LastFailure),
+		}
+		if !val.LockedUntil.IsZero() {
+			result[index].LockedUntilTime = timestamppb.New(val.LockedUntil)
+		}
+	}
+
+	return &userv1.ListLockoutsResponse{Lockouts: result}, nil
+}
+
+func (h *Handler) ClearLockout(ctx context.Context, req *userv1.ClearLockoutRequest) (*userv1.ClearLockoutResponse, error) {
+	log := applogger.FromContext(ctx, h.logger).Named("ClearLockout")
+
+	log.Debug("Request received", applogger.Proto("req", req))
+
+	u, err := h.authenticate(ctx)
+	if err != nil {
+		log.Error("Failed to authenticate user", zap.Error(err))
+		return nil, authError(err)
+	}
+
+	if !u.GetAdmin() {
+		log.Error("Failed to verify admin status")
+		return nil, status.Error(codes.PermissionDenied, "Permission denied")
+	}
+
+	if !h.lockouts.Clear(middleware.LockoutKind(req.GetKind()), req.GetSubject()) {
+		log.Error("No such lockout")
+		return nil, status.Error(codes.NotFound, "No such lockout")
+	}
+
+	return &userv1.ClearLockoutResponse{}, nil
+}
+
+func batchError(err error) *userv1.BatchError {
+	if err == nil {
+		return nil
+	}
+
+	code := codes.Internal
+	switch {
+	case errors.Is(err, usersservice.ErrInvalidUser):
+		code = codes.InvalidArgument
+	case errors.Is(err, usersservice.ErrDuplicateUser):
+		code = codes.AlreadyExists
+	case errors.Is(err, usersservice.ErrUserNotFound):
+		code = codes.NotFound
+	case errors.Is(err, usersservice.ErrDeleteSelf):
+		code = codes.FailedPrecondition
+	case errors.Is(err, usersservice.ErrBatchAborted):
+		code = codes.Aborted
+	}
+
+	return &userv1.BatchError{Code: int32(code), Message: err.Error()}
+}
+
+func batchStatus(err error) error {
+	if errors.Is(err, usersservice.ErrBatchTooLarge) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, "Failed to process batch")
+}
+
+func (h *Handler) BatchCreateUsers(ctx context.Context, req *userv1.BatchCreateUsersRequest) (*userv1.BatchCreateUsersResponse, error) {
+	log := applogger.FromContext(ctx, h.logger).Named("BatchCreateUsers")
+
+	log.Debug("Request received", zap.Int("count", len(req.GetRequests())), zap.Stringer("mode", req.GetMode()))
+
+	u, err := h.authenticate(ctx)
+	if err != nil {
+		log.Error("Failed to authenticate user", zap.Error(err))
+		return nil, authError(err)
+	}
+
+	if !u.GetAdmin() {
+		log.Error("Failed to verify admin status")
+		return nil, status.Error(codes.PermissionDenied, "Permission denied")
+	}
+
+	users := make([]*userv1.User, len(req.GetRequests()))
+	for i, item := range req.GetRequests() {
+		if item.GetAdmin() && apiKeyCaller(ctx) {
+			log.Error("Admin creation not allowed with an API key", zap.Int("item", i))
+			return nil, status.Error(codes.PermissionDenied, "Permission denied")
+		}
+
+		users[i] = &userv1.User{
+			Email:    item.GetEmail(),
+			Username: item.GetUsername(),
+			Password: item.GetPassword(),
+			Admin:    item.GetAdmin(),
+		}
+	}
+
+	results, err := h.service.BatchCreateUsers(ctx, users, req.GetMode() != userv1.BatchMode_BATCH_MODE_BEST_EFFORT)
+	if err != nil {
+		log.Error("Failed to create users", zap.Error(err))
+		return nil, batchStatus(err)
+	}
+
+	resp := &userv1.BatchCreateUsersResponse{Results: make([]*userv1.BatchCreateUsersResult, len(results))}
+	for i, result := range results {
+		resp.Results[i] = &userv1.BatchCreateUsersResult{
+			Id:    result.User.GetId(),
+			Error: batchError(result.Err),
+		}
+	}
+
+	return resp, nil
+}
+
+func (h *Handler) BatchGetUsers(ctx context.Context, req *userv1.BatchGetUsersRequest) (*userv1.BatchGetUsersResponse, error) {
+	log := applogger.FromContext(ctx, h.logger).Named("BatchGetUsers")
+
+	log.Debug("Request received", applogger.Proto("req", req))
+
+	results, err := h.service.BatchGetUsers(ctx, req.GetIds(), req.GetMode() != userv1.BatchMode_BATCH_MODE_BEST_EFFORT)
+	if err != nil {
+		log.Error("Failed to get users", zap.Error(err))
+		return nil, batchStatus(err)
+	}
+
+	resp := &userv1.BatchGetUsersResponse{Results: make([]*userv1.BatchGetUsersResult, len(results))}
+	for i, result := range results {
+		resp.Results[i] = &userv1.BatchGetUsersResult{Error: batchError(result.Err)}
+		if result.User != nil {
+			resp.Results[i].User = publicUser(result.User)
+		}
+	}
+
+	return resp, nil
+}
+
+func (h *Handler) BatchDeleteUsers(ctx context.Context, req *userv1.BatchDeleteUsersRequest) (*userv1.BatchDeleteUsersResponse, error) {
+	log := applogger.FromContext(ctx, h.logger).Named("BatchDeleteUsers")
+
+	log.Debug("Request received", applogger.Proto("req", req))
+
+	u, err := h.authenticate(ctx)
+	if err != nil {
+		log.Error("Failed to authenticate user", zap.Error(err))
+		return nil, authError(err)
+	}
+
+	if !u.GetAdmin() {
+		log.Error("Failed to verify admin status")
+		return nil, status.Error(codes.PermissionDenied, "Permission denied")
+	}
+
+	results, err := h.service.BatchDeleteUsers(ctx, u.GetId(), req.GetIds(), req.GetMode() != userv1.BatchMode_BATCH_MODE_BEST_EFFORT)
+	if err != nil {
+		log.Error("Failed to delete users", zap.Error(err))
+		return nil, batchStatus(err)
+	}
+
+	resp := &userv1.BatchDeleteUsersResponse{Results: make([]*userv1.BatchDeleteUsersResult, len(results))}
+	for i, result := range results {
+		resp.Results[i] = &userv1.BatchDeleteUsersResult{
+			Id:    req.GetIds()[i],
+			Error: batchError(result.Err),
+		}
+	}
+
+	return resp, nil
+}
+
+const exportChunkSize = 32 << 10
+
+// maxFilterLength bounds the filters anyone can send to GetUsers, along
+// with the nesting limit of the filter parser.
+const maxFilterLength = 1024
+
+func transferFormat(format userv1.TransferFormat) usersservice.Format {
+	if format == userv1.TransferFormat_TRANSFER_FORMAT_CSV {
+		return usersservice.FormatCSV
+	}
+	return usersservice.FormatJSONL
+}
+
+type exportWriter struct {
+	stream userv1.UserService_ExportUsersServer
+}
+
+func (w *exportWriter) Write(p []byte) (int, error) {
+	err := w.stream.Send(&userv1.ExportUsersResponse{Data: p})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (h *Handler) ExportUsers(req *userv1.ExportUsersRequest, stream userv1.UserService_ExportUsersServer) error {
+	ctx := stream.Context()
+
+	log := applogger.FromContext(ctx, h.logger).Named("ExportUsers")
+
+	log.Debug("Request received", applogger.Proto("req", req))
+
+	u, err := h.authenticate(ctx)
+	if err != nil {
+		log.Error("Failed to authenticate user", zap.Error(err))
+		return authError(err)
+	}
+
+	if !u.GetAdmin() {
+		log.Error("Failed to verify admin status")
+		return status.Error(codes.PermissionDenied, "Permission denied")
+	}
+
+	if req.GetIncludePasswordHashes() && !slices.Contains(u.GetPermissions(), usersservice.PermissionExportPasswordHashes) {
+		log.Error("Failed to verify export permission")
+		return status.Error(codes.PermissionDenied, "Exporting password hashes requires the "+usersservice.PermissionExportPasswordHashes+" permission")
+	}
+
+	if len(req.GetFilter()) > maxFilterLength {
+		log.Error("Filter too long", zap.Int("length", len(req.GetFilter())))
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Filter is longer than %d bytes", maxFilterLength))
+	}
+
+	w := bufio.NewWriterSize(&exportWriter{stream: stream}, exportChunkSize)
+
+	err = h.service.ExportUsers(ctx, w, transferFormat(req.GetFormat()), req.GetFilter(), req.GetIncludePasswordHashes())
+	if err == nil {
+		err = w.Flush()
+	}
+	if errors.Is(err, usersservice.ErrInvalidQuery) {
+		log.Error("Invalid query", zap.Error(err))
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		log.Error("Failed to export users", zap.Error(err))
+		return status.Error(codes.Internal, "Failed to export users")
+	}
+
+	return nil
+}
+
+type importReader struct {
+	stream userv1.UserService_ImportUsersServer
+	data   []byte
+}
+
+func (r *importReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.data = req.GetData()
+	}
+
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+
+	return n, nil
+}
+
+func (h *Handler) ImportUsers(stream userv1.UserService_ImportUsersServer) error {
+	ctx := stream.Context()
+
+	log := applogger.FromContext(ctx, h.logger).Named("ImportUsers")
+
+	u, err := h.authenticate(ctx)
+	if err != nil {
+		log.Error("Failed to authenticate user", zap.Error(err))
+		return authError(err)
+	}
+
+	if !u.GetAdmin() {
+		log.Error("Failed to verify admin status")
+		return status.Error(codes.PermissionDenied, "Permission denied")
+	}
+
+	first, err := stream.Recv()
+	if err != nil && !errors.Is(err, io.EOF) {
+		log.Error("Failed to receive import", zap.Error(err))
+		return err
+	}
+
+	options := usersservice.ImportOptions{
+		Format: transferFormat(first.GetFormat()),
+		Mode:   usersservice.ImportFailOnConflict,
+		DryRun: first.GetDryRun(),
+	}
+
+	switch first.GetMode() {
+	case userv1.ImportMode_IMPORT_MODE_SKIP:
+		options.Mode = usersservice.ImportSkip
+	case userv1.ImportMode_IMPORT_MODE_UPSERT:
+		options.Mode = usersservice.ImportUpsert
+	}
+
+	log.Debug("Request received", zap.String("format", string(options.Format)), zap.String("mode", string(options.Mode)), zap.Bool("dry_run", options.DryRun))
+
+	summary, err := h.service.ImportUsers(ctx, &importReader{stream: stream, data: first.GetData()}, options)
+	if errors.Is(err, usersservice.ErrInvalidImport) {
+		log.Error("Invalid import", zap.Error(err))
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		log.Error("Failed to import users", zap.Error(err))
+		return status.Error(codes.Internal, "Failed to import users")
+	}
+
+	resp := &userv1.ImportUsersResponse{
+		Total:   int32(summary.Total),
+		Created: int32(summary.Created),
+		Updated: int32(summary.Updated),
+		Skipped: int32(summary.Skipped),
+		Failed:  int32(summary.Failed),
+		Applied: summary.Applied,
+	}
+
+	for _, importError := range summary.Errors {
+		resp.Errors = append(resp.Errors, &userv1.ImportError{
+			Record:  int32(importError.Record),
+			Message: importError.Message,
+		})
+	}
+
+	return stream.SendAndClose(resp)
 }
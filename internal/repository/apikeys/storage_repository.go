@@ -0,0 +1,137 @@
+package apikeys
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/gorobot-nz/test-task/pkg/storage"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var tracer = otel.Tracer("github.com/gorobot-nz/test-task/internal/repository/apikeys")
+
+type Key struct {
+	Id        string
+	Name      string
+	UserId    string
+	Prefix    string
+	Hash      string
+	Scopes    []string
+	CreatedAt time.Time
+	ExpiresAt *time.Time
+	RevokedAt *time.Time
+}
+
+type StorageRepository struct {
+	store *storage.Storage[*Key]
+
+	logger *zap.Logger
+}
+
+func NewStorageRepository(logger *zap.Logger, store *storage.Storage[*Key]) *StorageRepository {
+	return &StorageRepository{
+		logger: logger,
+		store:  store,
+	}
+}
+
+func (s *StorageRepository) Create(ctx context.Context, key *Key) (string, error) {
+	_ = s.logger.Named("Create")
+	ctx, span := tracer.Start(ctx, "ApiKeysRepository.Create")
+	defer span.End()
+
+	for _, val := range s.store.List(ctx) {
+		if val.Prefix == key.Prefix {
+			return "", errors.New("not unique prefix")
+		}
+	}
+
+	key.Id = uuid.New().String()
+
+	stored := *key
+	stored.Scopes = slices.Clone(key.Scopes)
+
+	s.store.Set(ctx, key.Id, &stored)
+
+	return key.Id, nil
+}
+
+func (s *StorageRepository) List(ctx context.Context, userId string) ([]*Key, error) {
+	_ = s.logger.Named("List")
+	ctx, span := tracer.Start(ctx, "ApiKeysRepository.List")
+	defer span.End()
+
+	list := s.store.List(ctx)
+
+	if userId == "" {
+		return list, nil
+	}
+
+	result := make([]*Key, 0, len(list))
+
+	for _, val := range list {
+		if val.UserId == userId {
+			result = append(result, val)
+		}
+	}
+
+	return result, nil
+}
+
+func (s *StorageRepository) GetByPrefix(ctx context.Context, prefix string) (*Key, error) {
+	_ = s.logger.Named("GetByPrefix")
+	ctx, span := tracer.Start(ctx, "ApiKeysRepository.GetByPrefix")
+	defer span.End()
+
+	for _, val := range s.store.List(ctx) {
+		if val.Prefix == prefix {
+			return val, nil
+		}
+	}
+
+	return nil, errors.New("no such key")
+}
+
+func (s *StorageRepository) Revoke(ctx context.Context, id string, revokedAt time.Time) (*Key, error) {
+	_ = s.logger.Named("Revoke")
+	ctx, span := tracer.Start(ctx, "ApiKeysRepository.Revoke", trace.WithAttributes(attribute.String("api_key.id", id)))
+	defer span.End()
+
+	key, ok := s.store.Get(ctx, id)
+
+	if !ok {
+		return nil, errors.New("no such key")
+	}
+
+	if key.RevokedAt != nil {
+		return nil, errors.New("key already revoked")
+	}
+
+	revoked := *key
+	revoked.RevokedAt = &revokedAt
+
+	s.store.Set(ctx, id, &revoked)
+
+	return &revoked, nil
+}
+
+func (s *StorageRepository) DeleteByUser(ctx context.Context, userId string) error {
+	_ = s.logger.Named("DeleteByUser")
+	ctx, span := tracer.Start(ctx, "ApiKeysRepository.DeleteByUser")
+	defer span.End()
+
+	for _, val := range s.store.List(ctx) {
+		if val.UserId == userId {
+			s.store.Delete(ctx, val.Id)
+		}
+	}
+
+	return nil
+}
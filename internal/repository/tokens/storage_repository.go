@@ -0,0 +1,102 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gorobot-nz/test-task/pkg/storage"
+
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
+)
+
+var tracer = otel.Tracer("github.com/gorobot-nz/test-task/internal/repository/tokens")
+
+type Purpose string
+
+const (
+	PasswordReset     Purpose = "password_reset"
+	EmailVerification Purpose = "email_verification"
+)
+
+type Token struct {
+	Hash      string
+	UserId    string
+	Email     string
+	Purpose   Purpose
+	ExpiresAt time.Time
+}
+
+type StorageRepository struct {
+	store *storage.Storage[*Token]
+
+	logger *zap.Logger
+}
+
+func NewStorageRepository(logger *zap.Logger, store *storage.Storage[*Token]) *StorageRepository {
+	return &StorageRepository{
+		logger: logger,
+		store:  store,
+	}
+}
+
+func (s *StorageRepository) Create(ctx context.Context, token *Token) error {
+	_ = s.logger.Named("Create")
+	ctx, span := tracer.Start(ctx, "TokensRepository.Create")
+	defer span.End()
+
+	now := time.Now()
+
+	for _, val := range s.store.List(ctx) {
+		if now.After(val.ExpiresAt) {
+			s.store.Delete(ctx, val.Hash)
+		}
+	}
+
+	s.store.Set(ctx, token.Hash, &Token{
+		Hash:      token.Hash,
+		UserId:    token.UserId,
+		Email:     token.Email,
+		Purpose:   token.Purpose,
+		ExpiresAt: token.ExpiresAt,
+	})
+
+	return nil
+}
+
+func (s *StorageRepository) Consume(ctx context.Context, hash string, purpose Purpose) (*Token, error) {
+	_ = s.logger.Named("Consume")
+	ctx, span := tracer.Start(ctx, "TokensRepository.Consume")
+	defer span.End()
+
+	token, ok := s.store.Get(ctx, hash)
+
+	if !ok || token.Purpose != purpose {
+		return nil, errors.New("no such token")
+	}
+
+	if _, ok = s.store.Pop(ctx, hash); !ok {
+		return nil, errors.New("no such token")
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		return nil, errors.New("token expired")
+	}
+
+	return token, nil
+}
+
+func (s *StorageRepository) DeleteByUser(ctx context.Context, userId string, purpose Purpose) error {
+	_ = s.logger.Named("DeleteByUser")
+	ctx, span := tracer.Start(ctx, "TokensRepository.DeleteByUser")
+	defer span.End()
+
+	for _, val := range s.store.List(ctx) {
+		if val.UserId == userId && val.Purpose == purpose {
+			s.store.Delete(ctx, val.Hash)
+		}
+	}
+
+	return nil
+}
@@ -9,16 +9,23 @@ import (
 	"github.com/gorobot-nz/test-task/pkg/storage"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+var tracer = otel.Tracer("github.com/gorobot-nz/test-task/internal/repository/users")
+
 type StorageRepository struct {
-	store *storage.Storage[userv1.User]
+	store *storage.Storage[*userv1.User]
 
 	logger *zap.Logger
 }
 
-func NewStorageRepository(logger *zap.Logger, store *storage.Storage[userv1.User]) *StorageRepository {
+func NewStorageRepository(logger *zap.Logger, store *storage.Storage[*userv1.User]) *StorageRepository {
 	return &StorageRepository{
 		logger: logger,
 		store:  store,
@@ -27,30 +34,29 @@ func NewStorageRepository(logger *zap.Logger, store *storage.Storage[userv1.User
 
 func (s *StorageRepository) Create(ctx context.Context, user *userv1.User) (string, error) {
 	_ = s.logger.Named("Create")
+	ctx, span := tracer.Start(ctx, "UsersRepository.Create")
+	defer span.End()
 
-	user.Id = uuid.New().String()
+	if user.Id == "" {
+		user.Id = uuid.New().String()
+	} else if _, ok := s.store.Get(ctx, user.Id); ok {
+		return "", errors.New("user already exists")
+	}
+	if user.CreateTime == nil {
+		user.CreateTime = timestamppb.Now()
+	}
 
-	s.store.Set(user.GetId(), userv1.User{
-		Id:       user.GetId(),
-		Email:    user.GetEmail(),
-		Username: user.GetEmail(),
-		Password: user.GetPassword(),
-		Admin:    user.GetAdmin(),
-	})
+	s.store.Set(ctx, user.GetId(), proto.Clone(user).(*userv1.User))
 
 	return user.GetId(), nil
 }
 
 func (s *StorageRepository) List(ctx context.Context, page, limit int32) ([]*userv1.User, error) {
 	_ = s.logger.Named("List")
+	ctx, span := tracer.Start(ctx, "UsersRepository.List")
+	defer span.End()
 
-	list := s.store.List()
-
-	resultList := make([]*userv1.User, len(list))
-
-	for index := range resultList {
-		resultList[index] = &list[index]
-	}
+	resultList := s.store.List(ctx)
 
 	if page < 0 && limit < 0 {
 		return resultList, nil
@@ -59,8 +65,8 @@ func (s *StorageRepository) List(ctx context.Context, page, limit int32) ([]*use
 	offset := (page - 1) * limit
 	border := offset + limit
 
-	if offset >= int32(len(resultList)) {
-		return nil, errors.New("last page")
+	if offset < 0 || offset >= int32(len(resultList)) {
+		return nil, nil
 	}
 
 	if border >= int32(len(resultList)) {
@@ -74,51 +80,54 @@ func (s *StorageRepository) List(ctx context.Context, page, limit int32) ([]*use
 
 func (s *StorageRepository) GetById(ctx context.Context, id string) (*userv1.User, error) {
 	_ = s.logger.Named("GetById")
+	ctx, span := tracer.Start(ctx, "UsersRepository.GetById", trace.WithAttributes(attribute.String("user.id", id)))
+	defer span.End()
 
-	get, ok := s.store.Get(id)
+	get, ok := s.store.Get(ctx, id)
 
 	if !ok {
 		return nil, errors.New("no such user")
 	}
 
-	return &get, nil
+	return get, nil
 }
 
-func (s *StorageRepository) Update(ctx context.Context, user *userv1.User) (*userv1.User, error) {
-	_ = s.logger.Named("Update")
-
-	getUser, ok := s.store.Get(user.GetId())
-
-	var password = getUser.GetPassword()
-
-	if user.GetPassword() != "" {
-		password = user.GetPassword()
-	}
-
+// Modify applies fn to a copy of the stored user and saves the result,
+// atomically with respect to every other change to the store. If fn fails
+// the user is left as it was.
+func (s *StorageRepository) Modify(ctx context.Context, id string, fn func(user *userv1.User) error) (*userv1.User, error) {
+	_ = s.logger.Named("Modify")
+	ctx, span := tracer.Start(ctx, "UsersRepository.Modify", trace.WithAttributes(attribute.String("user.id", id)))
+	defer span.End()
+
+	updatedUser, ok, err := s.store.Update(ctx, id, func(user *userv1.User) (*userv1.User, error) {
+		updated := proto.Clone(user).(*userv1.User)
+		if err := fn(updated); err != nil {
+			return nil, err
+		}
+		return updated, nil
+	})
 	if !ok {
 		return nil, errors.New("no such user")
 	}
+	if err != nil {
+		return nil, err
+	}
 
-	s.store.Set(user.GetId(), userv1.User{
-		Id:       user.GetId(),
-		Email:    user.GetEmail(),
-		Username: user.GetEmail(),
-		Password: password,
-		Admin:    user.GetAdmin(),
-	})
-
-	return user, nil
+	return proto.Clone(updatedUser).(*userv1.User), nil
 }
 
 func (s *StorageRepository) Delete(ctx context.Context, id string) error {
 	_ = s.logger.Named("Delete")
+	ctx, span := tracer.Start(ctx, "UsersRepository.Delete", trace.WithAttributes(attribute.String("user.id", id)))
+	defer span.End()
 
-	_, ok := s.store.Get(id)
+	_, ok := s.store.Get(ctx, id)
 
 	if !ok {
 		return errors.New("no such user")
 	}
-	s.store.Delete(id)
+	s.store.Delete(ctx, id)
 
 	return nil
 }
@@ -0,0 +1,179 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	userv1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
+	"github.com/gorobot-nz/test-task/internal/repository/apikeys"
+	applogger "github.com/gorobot-nz/test-task/pkg/logger"
+	"github.com/gorobot-nz/test-task/pkg/middleware"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	apiKeyMarker     = "tt"
+	apiKeyPrefixSize = 5
+)
+
+var apiKeyPrefixEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func generateApiKey() (string, string, string, error) {
+	b := make([]byte, apiKeyPrefixSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+
+	prefix := strings.ToLower(apiKeyPrefixEncoding.EncodeToString(b))
+
+	secret, hash, err := generateToken()
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return fmt.Sprintf("%s_%s_%s", apiKeyMarker, prefix, secret), prefix, hash, nil
+}
+
+func parseApiKey(key string) (string, string, error) {
+	split := strings.SplitN(key, "_", 3)
+
+	if len(split) != 3 || split[0] != apiKeyMarker {
+		return "", "", errors.New("malformed api key")
+	}
+
+	return split[1], split[2], nil
+}
+
+func (s *Service) CreateApiKey(ctx context.Context, name, userId string, scopes []string, expiresAt *time.Time) (*apikeys.Key, string, error) {
+	log := applogger.FromContext(ctx, s.logger).Named("CreateApiKey")
+	ctx, span := tracer.Start(ctx, "UsersService.CreateApiKey")
+	defer span.End()
+
+	if name == "" {
+		return nil, "", errors.New("empty key name")
+	}
+
+	if len(scopes) == 0 {
+		return nil, "", errors.New("no scopes")
+	}
+
+	for _, scope := range scopes {
+		if !middleware.IsKnownScope(scope) {
+			return nil, "", fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", errors.New("expiry in the past")
+	}
+
+	_, err := s.repository.GetById(ctx, userId)
+	if err != nil {
+		log.Error("Failed to get user", zap.Error(err))
+		return nil, "", err
+	}
+
+	key, prefix, hash, err := generateApiKey()
+	if err != nil {
+		log.Error("Failed to generate key", zap.Error(err))
+		return nil, "", err
+	}
+
+	apiKey := &apikeys.Key{
+		Name:      name,
+		UserId:    userId,
+		Prefix:    prefix,
+		Hash:      hash,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	_, err = s.apiKeys.Create(ctx, apiKey)
+	if err != nil {
+		log.Error("Failed to save key", zap.Error(err))
+		return nil, "", err
+	}
+
+	return apiKey, key, nil
+}
+
+func (s *Service) ListApiKeys(ctx context.Context, userId string) ([]*apikeys.Key, error) {
+	log := applogger.FromContext(ctx, s.logger).Named("ListApiKeys")
+	ctx, span := tracer.Start(ctx, "UsersService.ListApiKeys")
+	defer span.End()
+
+	list, err := s.apiKeys.List(ctx, userId)
+	if err != nil {
+		log.Error("Failed to list keys", zap.Error(err))
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (s *Service) RevokeApiKey(ctx context.Context, id string) error {
+	log := applogger.FromContext(ctx, s.logger).Named("RevokeApiKey")
+	ctx, span := tracer.Start(ctx, "UsersService.RevokeApiKey", trace.WithAttributes(attribute.String("api_key.id", id)))
+	defer span.End()
+
+	_, err := s.apiKeys.Revoke(ctx, id, time.Now())
+	if err != nil {
+		log.Error("Failed to revoke key", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+var (
+	ErrWrongApiKey   = errors.New("wrong api key")
+	ErrApiKeyRevoked = errors.New("api key revoked")
+	ErrApiKeyExpired = errors.New("api key expired")
+)
+
+func (s *Service) AuthenticateApiKey(ctx context.Context, key string) (*userv1.User, []string, error) {
+	log := applogger.FromContext(ctx, s.logger).Named("AuthenticateApiKey")
+	ctx, span := tracer.Start(ctx, "UsersService.AuthenticateApiKey")
+	defer span.End()
+
+	prefix, secret, err := parseApiKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrWrongApiKey, err)
+	}
+
+	apiKey, err := s.apiKeys.GetByPrefix(ctx, prefix)
+	if err != nil {
+		log.Error("Failed to get key", zap.Error(err))
+		return nil, nil, fmt.Errorf("%w: %w", ErrWrongApiKey, err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey.Hash), []byte(hashToken(secret))) != 1 {
+		return nil, nil, ErrWrongApiKey
+	}
+
+	if apiKey.RevokedAt != nil {
+		return nil, nil, ErrApiKeyRevoked
+	}
+
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		return nil, nil, ErrApiKeyExpired
+	}
+
+	user, err := s.repository.GetById(ctx, apiKey.UserId)
+	if err != nil {
+		log.Error("Failed to get user", zap.Error(err))
+		return nil, nil, err
+	}
+
+	return user, apiKey.Scopes, nil
+}
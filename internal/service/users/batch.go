@@ -0,0 +1,220 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	userv1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
+	applogger "github.com/gorobot-nz/test-task/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+const MaxBatchSize = 1000
+
+var (
+	ErrBatchTooLarge = fmt.Errorf("batches are limited to %d items", MaxBatchSize)
+	ErrBatchAborted  = errors.New("aborted because another item failed")
+	ErrInvalidUser   = errors.New("invalid user")
+	ErrDuplicateUser = errors.New("not unique email or username")
+	ErrUserNotFound  = errors.New("no such user")
+	ErrDeleteSelf    = errors.New("can't delete yourself")
+)
+
+// BatchResult is the outcome of one item of a batch. Err is nil when the
+// item succeeded.
+type BatchResult struct {
+	User *userv1.User
+	Err  error
+}
+
+// abortBatch marks every successful item as aborted. It reports whether any
+// item had failed, i.e. whether an all-or-nothing batch must stop.
+func abortBatch(results []BatchResult) bool {
+	failed := false
+	for _, result := range results {
+		if result.Err != nil {
+			failed = true
+			break
+		}
+	}
+
+	if !failed {
+		return false
+	}
+
+	for i := range results {
+		if results[i].Err == nil {
+			results[i] = BatchResult{Err: ErrBatchAborted}
+		}
+	}
+
+	return true
+}
+
+// BatchCreateUsers validates all users and checks their uniqueness against
+// the store and each other with a single list of the repository, and hashes
+// their passwords, then creates the valid ones. With allOrNothing set
+// nothing is created unless every user is valid and hashed.
+func (s *Service) BatchCreateUsers(ctx context.Context, users []*userv1.User, allOrNothing bool) ([]BatchResult, error) {
+	log := applogger.FromContext(ctx, s.logger).Named("BatchCreateUsers")
+	ctx, span := tracer.Start(ctx, "UsersService.BatchCreateUsers")
+	defer span.End()
+
+	if len(users) > MaxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	list, err := s.repository.List(ctx, -1, -1)
+	if err != nil {
+		log.Error("Failed to list users", zap.Error(err))
+		return nil, err
+	}
+
+	taken := make(map[string]bool, 2*(len(list)+len(users)))
+	for _, val := range list {
+		taken["u:"+val.GetUsername()] = true
+		taken["e:"+val.GetEmail()] = true
+	}
+
+	results := make([]BatchResult, len(users))
+	passwords := make([]string, len(users))
+
+	for i, user := range users {
+		if err := validateNewUser(user); err != nil {
+			results[i].Err = fmt.Errorf("%w: %v", ErrInvalidUser, err)
+			continue
+		}
+
+		if taken["u:"+user.GetUsername()] || taken["e:"+user.GetEmail()] {
+			results[i].Err = ErrDuplicateUser
+			continue
+		}
+
+		taken["u:"+user.GetUsername()] = true
+		taken["e:"+user.GetEmail()] = true
+	}
+
+	// Every password is hashed before anything is created, so that a
+	// failure can still abort an all-or-nothing batch.
+	for i, user := range users {
+		if results[i].Err != nil {
+			continue
+		}
+
+		passwords[i], err = s.hasher.Hash(user.GetPassword())
+		if err != nil {
+			log.Error("Failed to generate password", zap.Int("item", i), zap.Error(err))
+			results[i].Err = fmt.Errorf("failed to hash password: %w", err)
+		}
+	}
+
+	if allOrNothing && abortBatch(results) {
+		return results, nil
+	}
+
+	for i, user := range users {
+		if results[i].Err != nil {
+			continue
+		}
+
+		created := &userv1.User{
+			Email:    user.GetEmail(),
+			Username: user.GetUsername(),
+			Password: passwords[i],
+			Admin:    user.GetAdmin(),
+		}
+
+		if _, err := s.repository.Create(ctx, created); err != nil {
+			log.Error("Failed to create user", zap.Error(err))
+			results[i].Err = err
+			continue
+		}
+
+		results[i].User = created
+
+		err = s.sendVerification(ctx, log, created.GetId(), created.GetEmail())
+		if err != nil {
+			log.Error("Failed to send verification", zap.Error(err))
+		}
+	}
+
+	return results, nil
+}
+
+func (s *Service) BatchGetUsers(ctx context.Context, ids []string, allOrNothing bool) ([]BatchResult, error) {
+	ctx, span := tracer.Start(ctx, "UsersService.BatchGetUsers")
+	defer span.End()
+
+	if len(ids) > MaxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	results := make([]BatchResult, len(ids))
+
+	for i, id := range ids {
+		user, err := s.repository.GetById(ctx, id)
+		if err != nil {
+			results[i].Err = ErrUserNotFound
+			continue
+		}
+		results[i].User = user
+	}
+
+	if allOrNothing {
+		abortBatch(results)
+	}
+
+	return results, nil
+}
+
+// BatchDeleteUsers deletes users on behalf of the user actorId, who can't
+// delete themselves. With allOrNothing set nothing is deleted unless every
+// user exists.
+func (s *Service) BatchDeleteUsers(ctx context.Context, actorId string, ids []string, allOrNothing bool) ([]BatchResult, error) {
+	log := applogger.FromContext(ctx, s.logger).Named("BatchDeleteUsers")
+	ctx, span := tracer.Start(ctx, "UsersService.BatchDeleteUsers")
+	defer span.End()
+
+	if len(ids) > MaxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	results := make([]BatchResult, len(ids))
+	seen := make(map[string]bool, len(ids))
+
+	for i, id := range ids {
+		switch {
+		case id == actorId:
+			results[i].Err = ErrDeleteSelf
+		case seen[id]:
+			results[i].Err = fmt.Errorf("%w: %s is listed twice", ErrInvalidUser, id)
+		default:
+			user, err := s.repository.GetById(ctx, id)
+			if err != nil {
+				results[i].Err = ErrUserNotFound
+				continue
+			}
+			results[i].User = user
+		}
+		seen[id] = true
+	}
+
+	if allOrNothing && abortBatch(results) {
+		return results, nil
+	}
+
+	for i, id := range ids {
+		if results[i].Err != nil {
+			continue
+		}
+
+		if err := s.DeleteUser(ctx, id); err != nil {
+			log.Error("Failed to delete user", zap.Error(err))
+			results[i] = BatchResult{Err: ErrUserNotFound}
+		}
+	}
+
+	return results, nil
+}
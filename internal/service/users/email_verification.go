@@ -0,0 +1,85 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	userv1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
+	"github.com/gorobot-nz/test-task/internal/repository/tokens"
+	applogger "github.com/gorobot-nz/test-task/pkg/logger"
+	"github.com/gorobot-nz/test-task/pkg/mailer"
+
+	"go.uber.org/zap"
+)
+
+const verificationTokenTTL = 24 * time.Hour
+
+// sendVerification mails a token that verifies email for the user. Without
+// a mailer it does nothing, and the email stays unverified.
+func (s *Service) sendVerification(ctx context.Context, log *zap.Logger, userId, email string) error {
+	if s.mailer == nil {
+		return nil
+	}
+
+	err := s.tokens.DeleteByUser(ctx, userId, tokens.EmailVerification)
+	if err != nil {
+		return err
+	}
+
+	token, hash, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	err = s.tokens.Create(ctx, &tokens.Token{
+		Hash:      hash,
+		UserId:    userId,
+		Email:     email,
+		Purpose:   tokens.EmailVerification,
+		ExpiresAt: time.Now().Add(verificationTokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	s.sendMail(log, mailer.Message{
+		To:      email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf(
+			"Use this token to verify your email address: %s\n\nIt expires in %v.\n",
+			token, verificationTokenTTL,
+		),
+	})
+
+	return nil
+}
+
+func (s *Service) VerifyEmail(ctx context.Context, token string) error {
+	log := applogger.FromContext(ctx, s.logger).Named("VerifyEmail")
+	ctx, span := tracer.Start(ctx, "UsersService.VerifyEmail")
+	defer span.End()
+
+	t, err := s.tokens.Consume(ctx, hashToken(token), tokens.EmailVerification)
+	if err != nil {
+		log.Error("Failed to consume token", zap.Error(err))
+		return err
+	}
+
+	_, err = s.repository.Modify(ctx, t.UserId, func(stored *userv1.User) error {
+		if stored.GetEmail() != t.Email {
+			return errors.New("email changed since token was issued")
+		}
+
+		stored.EmailVerified = true
+
+		return nil
+	})
+	if err != nil {
+		log.Error("Failed to update user", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
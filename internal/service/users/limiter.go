@@ -0,0 +1,51 @@
+package users
+
+import (
+	"sync"
+	"time"
+)
+
+type attemptLimiter struct {
+	m sync.Mutex
+
+	limit    int
+	window   time.Duration
+	attempts map[string][]time.Time
+}
+
+func newAttemptLimiter(limit int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		limit:    limit,
+		window:   window,
+		attempts: make(map[string][]time.Time),
+	}
+}
+
+func (l *attemptLimiter) Allow(key string) bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	now := time.Now()
+
+	for k, times := range l.attempts {
+		kept := times[:0]
+		for _, t := range times {
+			if now.Sub(t) < l.window {
+				kept = append(kept, t)
+			}
+		}
+		if len(kept) == 0 {
+			delete(l.attempts, k)
+		} else {
+			l.attempts[k] = kept
+		}
+	}
+
+	if len(l.attempts[key]) >= l.limit {
+		return false
+	}
+
+	l.attempts[key] = append(l.attempts[key], now)
+
+	return true
+}
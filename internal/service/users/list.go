@@ -0,0 +1,234 @@
+package users
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	userv1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
+	applogger "github.com/gorobot-nz/test-task/pkg/logger"
+	"github.com/gorobot-nz/test-task/pkg/query"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+	defaultOrderBy  = "create_time"
+)
+
+// Fields of a user that GetUsers can filter and order by.
+var (
+	filterFields = []string{"id", "email", "username", "admin", "email_verified", "totp_enabled", "create_time"}
+	orderFields  = []string{"username", "email", "create_time"}
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+type UsersQuery struct {
+	Filter    string
+	OrderBy   string
+	Search    string
+	PageSize  int32
+	PageToken string
+
+	// Page and Limit select a page by offset when set. Offsets shift when
+	// users are created or deleted between calls, page tokens don't.
+	Page  *int32
+	Limit *int32
+}
+
+type UsersPage struct {
+	Users         []*userv1.User
+	NextPageToken string
+	TotalSize     int32
+}
+
+// pageToken points after the last user of a page. It keeps the fields the
+// page is ordered by rather than an offset, so the next page starts at the
+// right user even if users before it were created or deleted meanwhile.
+type pageToken struct {
+	Query string `json:"q"`
+	Last  []byte `json:"l"`
+}
+
+func queryHash(q UsersQuery) string {
+	sum := sha256.Sum256([]byte(q.Filter + "\x00" + q.OrderBy + "\x00" + q.Search))
+	return hex.EncodeToString(sum[:8])
+}
+
+func encodePageToken(q UsersQuery, last *userv1.User) (string, error) {
+	cursor, err := proto.Marshal(&userv1.User{
+		Id:         last.GetId(),
+		Email:      last.GetEmail(),
+		Username:   last.GetUsername(),
+		CreateTime: last.GetCreateTime(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	b, err := json.Marshal(&pageToken{Query: queryHash(q), Last: cursor})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodePageToken(q UsersQuery) (*userv1.User, error) {
+	b, err := base64.RawURLEncoding.DecodeString(q.PageToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed page token", ErrInvalidQuery)
+	}
+
+	var token pageToken
+	if err := json.Unmarshal(b, &token); err != nil {
+		return nil, fmt.Errorf("%w: malformed page token", ErrInvalidQuery)
+	}
+
+	if token.Query != queryHash(q) {
+		return nil, fmt.Errorf("%w: page token doesn't match the query", ErrInvalidQuery)
+	}
+
+	var last userv1.User
+	if err := proto.Unmarshal(token.Last, &last); err != nil {
+		return nil, fmt.Errorf("%w: malformed page token", ErrInvalidQuery)
+	}
+
+	return &last, nil
+}
+
+// GetUsers lists users matching the query. The repository only supports
+// listing, so filtering, search and ordering are evaluated here and the
+// result is paged afterwards. Users are always ordered by id last to make
+// the order total.
+func (s *Service) GetUsers(ctx context.Context, q UsersQuery) (*UsersPage, error) {
+	log := applogger.FromContext(ctx, s.logger).Named("GetUsers")
+	ctx, span := tracer.Start(ctx, "UsersService.GetUsers")
+	defer span.End()
+
+	filter, err := query.ParseFilter(q.Filter, filterFields...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: filter: %v", ErrInvalidQuery, err)
+	}
+
+	order := q.OrderBy
+	if strings.TrimSpace(order) == "" {
+		order = defaultOrderBy
+	}
+
+	orderBy, err := query.ParseOrderBy(order, orderFields...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: order_by: %v", ErrInvalidQuery, err)
+	}
+
+	if q.PageSize < 0 {
+		return nil, fmt.Errorf("%w: negative page size", ErrInvalidQuery)
+	}
+
+	var last *userv1.User
+	if q.PageToken != "" {
+		last, err = decodePageToken(q)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	list, err := s.repository.List(ctx, -1, -1)
+	if err != nil {
+		log.Error("Failed to list users", zap.Error(err))
+		return nil, err
+	}
+
+	search := strings.ToLower(q.Search)
+
+	result := make([]*userv1.User, 0, len(list))
+	for _, user := range list {
+		if search != "" &&
+			!strings.HasPrefix(strings.ToLower(user.GetUsername()), search) &&
+			!strings.HasPrefix(strings.ToLower(user.GetEmail()), search) {
+			continue
+		}
+
+		ok, err := filter.Match(user)
+		if err != nil {
+			return nil, fmt.Errorf("%w: filter: %v", ErrInvalidQuery, err)
+		}
+		if ok {
+			result = append(result, user)
+		}
+	}
+
+	compare := func(a, b *userv1.User) int {
+		if result := orderBy.Compare(a, b); result != 0 {
+			return result
+		}
+		return strings.Compare(a.GetId(), b.GetId())
+	}
+
+	slices.SortFunc(result, compare)
+
+	page := &UsersPage{TotalSize: int32(len(result))}
+
+	if q.Page != nil || q.Limit != nil {
+		page.Users = offsetPage(result, q.Page, q.Limit)
+		return page, nil
+	}
+
+	start := 0
+	if last != nil {
+		start, _ = slices.BinarySearchFunc(result, last, compare)
+		if start < len(result) && compare(result[start], last) == 0 {
+			start++
+		}
+	}
+
+	size := int(q.PageSize)
+	if size == 0 {
+		size = defaultPageSize
+	}
+	if size > maxPageSize {
+		size = maxPageSize
+	}
+
+	end := min(start+size, len(result))
+	page.Users = result[start:end]
+
+	if end < len(result) {
+		page.NextPageToken, err = encodePageToken(q, result[end-1])
+		if err != nil {
+			log.Error("Failed to encode page token", zap.Error(err))
+			return nil, err
+		}
+	}
+
+	return page, nil
+}
+
+// offsetPage serves the deprecated page and limit parameters. Pages past the
+// end are empty.
+func offsetPage(list []*userv1.User, page, limit *int32) []*userv1.User {
+	p, l := 1, len(list)
+	if page != nil {
+		p = int(*page)
+	}
+	if limit != nil {
+		l = int(*limit)
+	}
+
+	offset := (p - 1) * l
+	if offset < 0 || l <= 0 || offset >= len(list) {
+		return nil
+	}
+
+	return list[offset:min(offset+l, len(list))]
+}
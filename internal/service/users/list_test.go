@@ -0,0 +1,136 @@
+package users_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	userv1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
+	usersrepository "github.com/gorobot-nz/test-task/internal/repository/users"
+	usersservice "github.com/gorobot-nz/test-task/internal/service/users"
+	"github.com/gorobot-nz/test-task/pkg/storage"
+
+	"go.uber.org/zap"
+)
+
+// newListService returns a service whose store holds count users, user0 to
+// user<count-1>, every third of them an admin.
+func newListService(t *testing.T, count int) (*usersservice.Service, *usersrepository.StorageRepository) {
+	t.Helper()
+
+	repository := usersrepository.NewStorageRepository(zap.NewNop(), storage.NewStorage[*userv1.User]("users"))
+	for i := 0; i < count; i++ {
+		addUser(t, repository, fmt.Sprintf("user%02d", i), i%3 == 0)
+	}
+
+	return usersservice.NewService(zap.NewNop(), repository, nil, nil, nil, nil, nil, usersservice.Config{}), repository
+}
+
+func addUser(t *testing.T, repository *usersrepository.StorageRepository, username string, admin bool) {
+	t.Helper()
+
+	_, err := repository.Create(context.Background(), &userv1.User{
+		Email:    username + "@example.com",
+		Username: username,
+		Admin:    admin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func usernames(users []*userv1.User) []string {
+	result := make([]string, len(users))
+	for i, user := range users {
+		result[i] = user.GetUsername()
+	}
+	return result
+}
+
+// TestPageTokens walks every page, creating a user before the cursor midway,
+// and checks no user is skipped or repeated.
+func TestPageTokens(t *testing.T) {
+	service, repository := newListService(t, 10)
+	ctx := context.Background()
+
+	q := usersservice.UsersQuery{OrderBy: "username", PageSize: 3}
+
+	var got []string
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("Paging doesn't end")
+		}
+
+		page, err := service.GetUsers(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.TotalSize != int32(10+min(pages, 1)) {
+			t.Errorf("Page %d: total size %d", pages, page.TotalSize)
+		}
+		got = append(got, usernames(page.Users)...)
+
+		if pages == 0 {
+			addUser(t, repository, "user00a", false)
+		}
+
+		if page.NextPageToken == "" {
+			break
+		}
+		q.PageToken = page.NextPageToken
+	}
+
+	want := []string{"user00", "user01", "user02", "user03", "user04", "user05", "user06", "user07", "user08", "user09"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Got %v, want %v", got, want)
+	}
+}
+
+func TestPageTokenMismatch(t *testing.T) {
+	service, _ := newListService(t, 10)
+	ctx := context.Background()
+
+	first := usersservice.UsersQuery{Filter: "admin = true", OrderBy: "username", Search: "user", PageSize: 1}
+	page, err := service.GetUsers(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.NextPageToken == "" {
+		t.Fatal("No next page token")
+	}
+	token := page.NextPageToken
+
+	tests := []struct {
+		name  string
+		query usersservice.UsersQuery
+		valid bool
+	}{
+		{"same query", usersservice.UsersQuery{Filter: first.Filter, OrderBy: first.OrderBy, Search: first.Search, PageToken: token}, true},
+		{"other page size", usersservice.UsersQuery{Filter: first.Filter, OrderBy: first.OrderBy, Search: first.Search, PageSize: 5, PageToken: token}, true},
+		{"other filter", usersservice.UsersQuery{Filter: "admin = false", OrderBy: first.OrderBy, Search: first.Search, PageToken: token}, false},
+		{"no filter", usersservice.UsersQuery{OrderBy: first.OrderBy, Search: first.Search, PageToken: token}, false},
+		{"other order", usersservice.UsersQuery{Filter: first.Filter, OrderBy: "email", Search: first.Search, PageToken: token}, false},
+		{"other search", usersservice.UsersQuery{Filter: first.Filter, OrderBy: first.OrderBy, Search: "user0", PageToken: token}, false},
+		{"malformed", usersservice.UsersQuery{Filter: first.Filter, OrderBy: first.OrderBy, Search: first.Search, PageToken: "!"}, false},
+		{"not json", usersservice.UsersQuery{Filter: first.Filter, OrderBy: first.OrderBy, Search: first.Search, PageToken: "bm90IGpzb24"}, false},
+		{"truncated", usersservice.UsersQuery{Filter: first.Filter, OrderBy: first.OrderBy, Search: first.Search, PageToken: token[:len(token)/2]}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.GetUsers(ctx, tt.query)
+			if tt.valid {
+				if err != nil {
+					t.Errorf("GetUsers: %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, usersservice.ErrInvalidQuery) {
+				t.Errorf("GetUsers: %v, want ErrInvalidQuery", err)
+			}
+		})
+	}
+}
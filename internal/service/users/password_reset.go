@@ -0,0 +1,136 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	userv1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
+	"github.com/gorobot-nz/test-task/internal/repository/tokens"
+	applogger "github.com/gorobot-nz/test-task/pkg/logger"
+	"github.com/gorobot-nz/test-task/pkg/mailer"
+	"github.com/gorobot-nz/test-task/pkg/validation"
+
+	"go.uber.org/zap"
+)
+
+const (
+	resetTokenTTL       = 30 * time.Minute
+	resetRequestsLimit  = 3
+	resetRequestsWindow = time.Hour
+)
+
+var ErrRateLimited = errors.New("too many requests")
+
+// ErrMailDisabled is returned for password resets when the service has no
+// mailer to send the token with.
+var ErrMailDisabled = errors.New("mail is not configured")
+
+func (s *Service) getUserByEmail(ctx context.Context, email string) (*userv1.User, error) {
+	list, err := s.repository.List(ctx, -1, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, val := range list {
+		if strings.EqualFold(val.GetEmail(), email) {
+			return val, nil
+		}
+	}
+
+	return nil, ErrUserNotFound
+}
+
+func (s *Service) RequestPasswordReset(ctx context.Context, email string) error {
+	log := applogger.FromContext(ctx, s.logger).Named("RequestPasswordReset")
+	ctx, span := tracer.Start(ctx, "UsersService.RequestPasswordReset")
+	defer span.End()
+
+	if s.mailer == nil {
+		return ErrMailDisabled
+	}
+
+	if !s.resetLimiter.Allow(strings.ToLower(email)) {
+		return ErrRateLimited
+	}
+
+	user, err := s.getUserByEmail(ctx, email)
+	if err != nil {
+		// The caller gets the same answer whether the address is known or
+		// not, so nobody can probe which emails have accounts.
+		log.Debug("Password reset requested for unknown email")
+		return nil
+	}
+
+	token, hash, err := generateToken()
+	if err != nil {
+		log.Error("Failed to generate token", zap.Error(err))
+		return err
+	}
+
+	err = s.tokens.Create(ctx, &tokens.Token{
+		Hash:      hash,
+		UserId:    user.GetId(),
+		Purpose:   tokens.PasswordReset,
+		ExpiresAt: time.Now().Add(resetTokenTTL),
+	})
+	if err != nil {
+		log.Error("Failed to save token", zap.Error(err))
+		return err
+	}
+
+	message := mailer.Message{
+		To:      user.GetEmail(),
+		Subject: "Password reset",
+		Body: fmt.Sprintf(
+			"Use this token to reset your password: %s\n\nIt expires in %v. If you didn't ask for a reset, ignore this email.\n",
+			token, resetTokenTTL,
+		),
+	}
+
+	// Sending happens in the background so response timing doesn't
+	// reveal whether a mail went out.
+	s.sendMail(log, message)
+
+	return nil
+}
+
+func (s *Service) ResetPassword(ctx context.Context, token, newPassword string) error {
+	log := applogger.FromContext(ctx, s.logger).Named("ResetPassword")
+	ctx, span := tracer.Start(ctx, "UsersService.ResetPassword")
+	defer span.End()
+
+	if !validation.IsValidPassword(newPassword) {
+		return errors.New("failure password validation")
+	}
+
+	t, err := s.tokens.Consume(ctx, hashToken(token), tokens.PasswordReset)
+	if err != nil {
+		log.Error("Failed to consume token", zap.Error(err))
+		return err
+	}
+
+	password, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		log.Error("Failed to generate password", zap.Error(err))
+		return err
+	}
+
+	_, err = s.repository.Modify(ctx, t.UserId, func(stored *userv1.User) error {
+		stored.Password = password
+		return nil
+	})
+	if err != nil {
+		log.Error("Failed to update user", zap.Error(err))
+		return err
+	}
+
+	err = s.tokens.DeleteByUser(ctx, t.UserId, tokens.PasswordReset)
+	if err != nil {
+		log.Error("Failed to delete remaining tokens", zap.Error(err))
+	}
+
+	return nil
+}
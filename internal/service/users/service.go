@@ -3,67 +3,128 @@ package users
 import (
 	"context"
 	"errors"
+	"fmt"
 	userv1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
+	"github.com/gorobot-nz/test-task/internal/repository/apikeys"
+	"github.com/gorobot-nz/test-task/internal/repository/tokens"
+	"github.com/gorobot-nz/test-task/pkg/encryption"
+	applogger "github.com/gorobot-nz/test-task/pkg/logger"
+	"github.com/gorobot-nz/test-task/pkg/mailer"
 	"github.com/gorobot-nz/test-task/pkg/validation"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/protobuf/proto"
+	"slices"
+	"time"
 )
 
+var tracer = otel.Tracer("github.com/gorobot-nz/test-task/internal/service/users")
+
 type Repository interface {
 	Create(ctx context.Context, user *userv1.User) (string, error)
 	List(ctx context.Context, page, limit int32) ([]*userv1.User, error)
 	GetById(ctx context.Context, id string) (*userv1.User, error)
-	Update(ctx context.Context, user *userv1.User) (*userv1.User, error)
+	Modify(ctx context.Context, id string, fn func(user *userv1.User) error) (*userv1.User, error)
 	Delete(ctx context.Context, id string) error
 }
 
+type TokenRepository interface {
+	Create(ctx context.Context, token *tokens.Token) error
+	Consume(ctx context.Context, hash string, purpose tokens.Purpose) (*tokens.Token, error)
+	DeleteByUser(ctx context.Context, userId string, purpose tokens.Purpose) error
+}
+
+type ApiKeyRepository interface {
+	Create(ctx context.Context, key *apikeys.Key) (string, error)
+	List(ctx context.Context, userId string) ([]*apikeys.Key, error)
+	GetByPrefix(ctx context.Context, prefix string) (*apikeys.Key, error)
+	Revoke(ctx context.Context, id string, revokedAt time.Time) (*apikeys.Key, error)
+	DeleteByUser(ctx context.Context, userId string) error
+}
+
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(encoded, password string) error
+	NeedsRehash(encoded string) bool
+	Validate(encoded string) error
+}
+
 type Service struct {
 	repository Repository
+	tokens     TokenRepository
+	apiKeys    ApiKeyRepository
+	mailer     mailer.Mailer
+	hasher     PasswordHasher
+
+	secrets *encryption.Cipher
+
+	resetLimiter *attemptLimiter
+
+	config Config
 
 	logger *zap.Logger
 }
 
-func NewService(logger *zap.Logger, repository Repository) *Service {
+type Config struct {
+	RequireVerifiedEmail bool
+	TOTPIssuer           string
+}
+
+// NewService creates the user service. mailer and secrets may be nil, which
+// disables password resets and verification emails, and TOTP respectively.
+func NewService(logger *zap.Logger, repository Repository, tokens TokenRepository, apiKeys ApiKeyRepository, mailer mailer.Mailer, hasher PasswordHasher, secrets *encryption.Cipher, config Config) *Service {
 	return &Service{
-		logger:     logger,
-		repository: repository,
+		logger:       logger,
+		repository:   repository,
+		tokens:       tokens,
+		apiKeys:      apiKeys,
+		mailer:       mailer,
+		hasher:       hasher,
+		secrets:      secrets,
+		resetLimiter: newAttemptLimiter(resetRequestsLimit, resetRequestsWindow),
+		config:       config,
 	}
 }
 
-func (s *Service) NewUser(ctx context.Context, user *userv1.User) (string, error) {
-	log := s.logger.Named("NewUser")
-
+func validateNewUser(user *userv1.User) error {
 	if !validation.IsValidEmail(user.GetEmail()) {
-		return "", errors.New("failure mail validation")
+		return errors.New("failure mail validation")
 	}
 
 	if !validation.IsValidPassword(user.GetPassword()) {
-		return "", errors.New("failure password validation")
+		return errors.New("failure password validation")
 	}
 
 	if !validation.IsValidUsername(user.GetUsername()) {
-		return "", errors.New("failure username validation")
+		return errors.New("failure username validation")
 	}
 
-	list, err := s.repository.List(ctx, -1, -1)
-	if err != nil {
-		log.Error("Failed to list users", zap.Error(err))
+	return nil
+}
+
+func (s *Service) NewUser(ctx context.Context, user *userv1.User) (string, error) {
+	log := applogger.FromContext(ctx, s.logger).Named("NewUser")
+	ctx, span := tracer.Start(ctx, "UsersService.NewUser")
+	defer span.End()
+
+	if err := validateNewUser(user); err != nil {
 		return "", err
 	}
 
-	for _, val := range list {
-		if val.GetUsername() == user.GetUsername() || val.GetEmail() == user.GetEmail() {
-			return "", errors.New("not unique email or username")
-		}
+	if err := s.checkUnique(ctx, log, user); err != nil {
+		return "", err
 	}
 
-	password, err := bcrypt.GenerateFromPassword([]byte(user.GetPassword()), 10)
+	password, err := s.hasher.Hash(user.GetPassword())
 	if err != nil {
 		log.Error("Failed to generate password", zap.Error(err))
 		return "", err
 	}
 
-	user.Password = string(password)
+	user.Password = password
+	user.EmailVerified = false
 
 	id, err := s.repository.Create(ctx, user)
 	if err != nil {
@@ -71,23 +132,18 @@ func (s *Service) NewUser(ctx context.Context, user *userv1.User) (string, error
 		return "", err
 	}
 
-	return id, nil
-}
-
-func (s *Service) GetUsers(ctx context.Context, page, limit int32) ([]*userv1.User, error) {
-	log := s.logger.Named("GetUsers")
-
-	list, err := s.repository.List(ctx, page, limit)
+	err = s.sendVerification(ctx, log, id, user.GetEmail())
 	if err != nil {
-		log.Error("Failed to list users", zap.Error(err))
-		return nil, err
+		log.Error("Failed to send verification", zap.Error(err))
 	}
 
-	return list, nil
+	return id, nil
 }
 
 func (s *Service) GetUserById(ctx context.Context, id string) (*userv1.User, error) {
-	log := s.logger.Named("GetUserById")
+	log := applogger.FromContext(ctx, s.logger).Named("GetUserById")
+	ctx, span := tracer.Start(ctx, "UsersService.GetUserById", trace.WithAttributes(attribute.String("user.id", id)))
+	defer span.End()
 
 	user, err := s.repository.GetById(ctx, id)
 	if err != nil {
@@ -99,7 +155,9 @@ func (s *Service) GetUserById(ctx context.Context, id string) (*userv1.User, err
 }
 
 func (s *Service) GetUserByUsername(ctx context.Context, username string) (*userv1.User, error) {
-	log := s.logger.Named("GetUserByUsername")
+	log := applogger.FromContext(ctx, s.logger).Named("GetUserByUsername")
+	ctx, span := tracer.Start(ctx, "UsersService.GetUserByUsername")
+	defer span.End()
 
 	list, err := s.repository.List(ctx, -1, -1)
 	if err != nil {
@@ -113,45 +171,362 @@ func (s *Service) GetUserByUsername(ctx context.Context, username string) (*user
 		}
 	}
 
-	return nil, errors.New("no such user")
+	return nil, ErrUserNotFound
 }
 
-func (s *Service) UpdateUser(ctx context.Context, user *userv1.User) (*userv1.User, error) {
-	log := s.logger.Named("UpdateUser")
+var (
+	ErrWrongPassword    = errors.New("wrong password")
+	ErrEmailNotVerified = errors.New("email not verified")
 
-	if !validation.IsValidEmail(user.GetEmail()) {
-		return nil, errors.New("failure mail validation")
+	errPasswordChanged = errors.New("password changed concurrently")
+)
+
+func (s *Service) Authenticate(ctx context.Context, username, password, passcode string) (*userv1.User, error) {
+	log := applogger.FromContext(ctx, s.logger).Named("Authenticate")
+	ctx, span := tracer.Start(ctx, "UsersService.Authenticate")
+	defer span.End()
+
+	user, err := s.GetUserByUsername(ctx, username)
+	if err != nil {
+		log.Error("Failed to get user", zap.Error(err))
+		return nil, err
 	}
 
-	if user.GetPassword() != "" && !validation.IsValidPassword(user.GetPassword()) {
-		return nil, errors.New("failure password validation")
+	err = s.hasher.Verify(user.GetPassword(), password)
+	if err != nil {
+		log.Error("Failed to verify password", zap.Error(err))
+		return nil, ErrWrongPassword
 	}
 
-	if !validation.IsValidUsername(user.GetUsername()) {
-		return nil, errors.New("failure username validation")
+	if s.config.RequireVerifiedEmail && !user.GetEmailVerified() {
+		return nil, ErrEmailNotVerified
+	}
+
+	if user.GetTotpEnabled() {
+		user, err = s.verifySecondFactor(ctx, user, passcode)
+		if err != nil {
+			log.Error("Failed to verify second factor", zap.Error(err))
+			return nil, err
+		}
+	}
+
+	if s.hasher.NeedsRehash(user.GetPassword()) {
+		rehashed, err := s.rehash(ctx, user, password)
+		if err != nil {
+			log.Error("Failed to rehash password", zap.Error(err))
+		} else {
+			user = rehashed
+		}
+	}
+
+	return user, nil
+}
+
+// rehash replaces a hash made with outdated parameters. It's only called
+// once the login succeeded, the one moment the plaintext is known, and
+// leaves the hash alone if the password was changed in the meantime.
+func (s *Service) rehash(ctx context.Context, user *userv1.User, password string) (*userv1.User, error) {
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repository.Modify(ctx, user.GetId(), func(stored *userv1.User) error {
+		if stored.GetPassword() != user.GetPassword() {
+			return errPasswordChanged
+		}
+
+		stored.Password = hash
+
+		return nil
+	})
+}
+
+func (s *Service) AuthenticateCertificate(ctx context.Context, principal string) (*userv1.User, error) {
+	log := applogger.FromContext(ctx, s.logger).Named("AuthenticateCertificate")
+	ctx, span := tracer.Start(ctx, "UsersService.AuthenticateCertificate")
+	defer span.End()
+
+	user, err := s.GetUserByUsername(ctx, principal)
+	if err != nil {
+		user, err = s.getUserByEmail(ctx, principal)
+	}
+	if err != nil {
+		log.Error("Failed to get user", zap.Error(err))
+		return nil, err
+	}
+
+	if s.config.RequireVerifiedEmail && !user.GetEmailVerified() {
+		return nil, ErrEmailNotVerified
+	}
+
+	return user, nil
+}
+
+// checkUnique returns ErrDuplicateUser when a user other than user already
+// has its username or email.
+func (s *Service) checkUnique(ctx context.Context, log *zap.Logger, user *userv1.User) error {
+	list, err := s.repository.List(ctx, -1, -1)
+	if err != nil {
+		log.Error("Failed to list users", zap.Error(err))
+		return err
+	}
+
+	for _, val := range list {
+		if user.GetId() != "" && val.GetId() == user.GetId() {
+			continue
+		}
+		if val.GetUsername() == user.GetUsername() || val.GetEmail() == user.GetEmail() {
+			return ErrDuplicateUser
+		}
+	}
+
+	return nil
+}
+
+// Paths accepted in an UpdateUser field mask.
+const (
+	FieldEmail       = "email"
+	FieldUsername    = "username"
+	FieldPassword    = "password"
+	FieldAdmin       = "admin"
+	FieldPermissions = "permissions"
+)
+
+// PermissionExportPasswordHashes allows an admin to include password hashes
+// in exports.
+const PermissionExportPasswordHashes = "users.export_password_hashes"
+
+func IsKnownPermission(permission string) bool {
+	return permission == PermissionExportPasswordHashes
+}
+
+var ErrInvalidUpdateMask = errors.New("invalid update mask")
+
+// UpdateUser copies the fields named in paths from user onto the stored
+// user. Fields that are not listed are left untouched and not validated.
+func (s *Service) UpdateUser(ctx context.Context, user *userv1.User, paths []string) (*userv1.User, error) {
+	log := applogger.FromContext(ctx, s.logger).Named("UpdateUser")
+	ctx, span := tracer.Start(ctx, "UsersService.UpdateUser", trace.WithAttributes(attribute.String("user.id", user.GetId())))
+	defer span.End()
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%w: no fields to update", ErrInvalidUpdateMask)
 	}
 
-	if user.GetPassword() != "" {
-		password, err := bcrypt.GenerateFromPassword([]byte(user.GetPassword()), 10)
+	for _, path := range paths {
+		switch path {
+		case FieldEmail:
+			if !validation.IsValidEmail(user.GetEmail()) {
+				return nil, errors.New("failure mail validation")
+			}
+		case FieldUsername:
+			if !validation.IsValidUsername(user.GetUsername()) {
+				return nil, errors.New("failure username validation")
+			}
+		case FieldPassword:
+			if !validation.IsValidPassword(user.GetPassword()) {
+				return nil, errors.New("failure password validation")
+			}
+		case FieldAdmin:
+		case FieldPermissions:
+			for _, permission := range user.GetPermissions() {
+				if !IsKnownPermission(permission) {
+					return nil, fmt.Errorf("unknown permission %q", permission)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidUpdateMask, path)
+		}
+	}
+
+	var password string
+	if slices.Contains(paths, FieldPassword) {
+		var err error
+		password, err = s.hasher.Hash(user.GetPassword())
 		if err != nil {
 			log.Error("Failed to generate password", zap.Error(err))
 			return nil, err
 		}
+	}
 
-		user.Password = string(password)
+	apply := func(target *userv1.User) {
+		for _, path := range paths {
+			switch path {
+			case FieldEmail:
+				target.Email = user.GetEmail()
+			case FieldUsername:
+				target.Username = user.GetUsername()
+			case FieldAdmin:
+				target.Admin = user.GetAdmin()
+			case FieldPermissions:
+				permissions := slices.Clone(user.GetPermissions())
+				slices.Sort(permissions)
+				target.Permissions = slices.Compact(permissions)
+			case FieldPassword:
+				target.Password = password
+			}
+		}
 	}
 
-	updatedUser, err := s.repository.Update(ctx, user)
+	existing, err := s.repository.GetById(ctx, user.GetId())
+	if err != nil {
+		log.Error("Failed to get user", zap.Error(err))
+		return nil, err
+	}
+
+	candidate := proto.Clone(existing).(*userv1.User)
+	apply(candidate)
+
+	if candidate.GetEmail() != existing.GetEmail() || candidate.GetUsername() != existing.GetUsername() {
+		if err := s.checkUnique(ctx, log, candidate); err != nil {
+			return nil, err
+		}
+	}
+
+	var emailChanged bool
+	updatedUser, err := s.repository.Modify(ctx, user.GetId(), func(stored *userv1.User) error {
+		email := stored.GetEmail()
+		apply(stored)
+
+		emailChanged = stored.GetEmail() != email
+		if emailChanged {
+			stored.EmailVerified = false
+		}
+
+		return nil
+	})
 	if err != nil {
 		log.Error("Failed to update user", zap.Error(err))
 		return nil, err
 	}
 
+	if emailChanged {
+		err = s.sendVerification(ctx, log, updatedUser.GetId(), updatedUser.GetEmail())
+		if err != nil {
+			log.Error("Failed to send verification", zap.Error(err))
+		}
+	}
+
 	return updatedUser, nil
 }
 
+func (s *Service) UpdateMe(ctx context.Context, id string, email, username *string) (*userv1.User, error) {
+	log := applogger.FromContext(ctx, s.logger).Named("UpdateMe")
+	ctx, span := tracer.Start(ctx, "UsersService.UpdateMe", trace.WithAttributes(attribute.String("user.id", id)))
+	defer span.End()
+
+	user, err := s.repository.GetById(ctx, id)
+	if err != nil {
+		log.Error("Failed to get user", zap.Error(err))
+		return nil, err
+	}
+
+	if email != nil && !validation.IsValidEmail(*email) {
+		return nil, errors.New("failure mail validation")
+	}
+
+	if username != nil && !validation.IsValidUsername(*username) {
+		return nil, errors.New("failure username validation")
+	}
+
+	apply := func(target *userv1.User) {
+		if email != nil {
+			target.Email = *email
+		}
+		if username != nil {
+			target.Username = *username
+		}
+	}
+
+	candidate := proto.Clone(user).(*userv1.User)
+	apply(candidate)
+
+	if err := s.checkUnique(ctx, log, candidate); err != nil {
+		return nil, err
+	}
+
+	var emailChanged bool
+	updatedUser, err := s.repository.Modify(ctx, id, func(stored *userv1.User) error {
+		previous := stored.GetEmail()
+		apply(stored)
+
+		emailChanged = stored.GetEmail() != previous
+		if emailChanged {
+			stored.EmailVerified = false
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Error("Failed to update user", zap.Error(err))
+		return nil, err
+	}
+
+	if emailChanged {
+		err = s.sendVerification(ctx, log, updatedUser.GetId(), updatedUser.GetEmail())
+		if err != nil {
+			log.Error("Failed to send verification", zap.Error(err))
+		}
+	}
+
+	return updatedUser, nil
+}
+
+func (s *Service) ChangePassword(ctx context.Context, id, currentPassword, newPassword string) error {
+	log := applogger.FromContext(ctx, s.logger).Named("ChangePassword")
+	ctx, span := tracer.Start(ctx, "UsersService.ChangePassword", trace.WithAttributes(attribute.String("user.id", id)))
+	defer span.End()
+
+	user, err := s.repository.GetById(ctx, id)
+	if err != nil {
+		log.Error("Failed to get user", zap.Error(err))
+		return err
+	}
+
+	err = s.hasher.Verify(user.GetPassword(), currentPassword)
+	if err != nil {
+		log.Error("Failed to verify current password", zap.Error(err))
+		return ErrWrongPassword
+	}
+
+	if !validation.IsValidPassword(newPassword) {
+		return errors.New("failure password validation")
+	}
+
+	if currentPassword == newPassword {
+		return errors.New("new password matches current one")
+	}
+
+	password, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		log.Error("Failed to generate password", zap.Error(err))
+		return err
+	}
+
+	// Credentials are sent with every call, so replacing the hash is
+	// enough to reject any other client still using the old password.
+	_, err = s.repository.Modify(ctx, id, func(stored *userv1.User) error {
+		if stored.GetPassword() != user.GetPassword() {
+			return errPasswordChanged
+		}
+
+		stored.Password = password
+
+		return nil
+	})
+	if err != nil {
+		log.Error("Failed to update user", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
 func (s *Service) DeleteUser(ctx context.Context, id string) error {
-	log := s.logger.Named("DeleteUser")
+	log := applogger.FromContext(ctx, s.logger).Named("DeleteUser")
+	ctx, span := tracer.Start(ctx, "UsersService.DeleteUser", trace.WithAttributes(attribute.String("user.id", id)))
+	defer span.End()
 
 	err := s.repository.Delete(ctx, id)
 	if err != nil {
@@ -159,5 +534,11 @@ func (s *Service) DeleteUser(ctx context.Context, id string) error {
 		return err
 	}
 
+	err = s.apiKeys.DeleteByUser(ctx, id)
+	if err != nil {
+		log.Error("Failed to delete user api keys", zap.Error(err))
+		return err
+	}
+
 	return nil
 }
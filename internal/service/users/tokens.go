@@ -0,0 +1,43 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/gorobot-nz/test-task/pkg/mailer"
+
+	"go.uber.org/zap"
+)
+
+const mailSendTimeout = 30 * time.Second
+
+func generateToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Service) sendMail(log *zap.Logger, message mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+
+		if err := s.mailer.Send(ctx, message); err != nil {
+			log.Error("Failed to send mail", zap.Error(err))
+		}
+	}()
+}
@@ -0,0 +1,262 @@
+package users
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	userv1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
+	applogger "github.com/gorobot-nz/test-task/pkg/logger"
+	"github.com/gorobot-nz/test-task/pkg/totp"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	recoveryCodesCount = 10
+	recoveryCodeLength = 10
+
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeLength)
+	alphabetSize := big.NewInt(int64(len(recoveryCodeAlphabet)))
+
+	for i := range b {
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		b[i] = recoveryCodeAlphabet[n.Int64()]
+	}
+
+	return fmt.Sprintf("%s-%s", b[:recoveryCodeLength/2], b[recoveryCodeLength/2:]), nil
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Service) totpSecret(user *userv1.User) ([]byte, error) {
+	if s.secrets == nil {
+		return nil, errors.New("totp is not configured")
+	}
+
+	if user.GetTotpSecret() == "" {
+		return nil, errors.New("totp is not enrolled")
+	}
+
+	return s.secrets.OpenString(user.GetTotpSecret())
+}
+
+var (
+	ErrSecondFactorRequired = errors.New("second factor required")
+	ErrWrongSecondFactor    = errors.New("wrong second factor")
+)
+
+// useTOTPStep records step as the last accepted one, unless a code for it or
+// a later step was already accepted. It must be called from a
+// Repository.Modify callback.
+func useTOTPStep(user *userv1.User, step int64) error {
+	if step <= int64(user.GetTotpLastStep()) {
+		return ErrWrongSecondFactor
+	}
+
+	user.TotpLastStep = uint32(step)
+
+	return nil
+}
+
+// verifySecondFactor accepts either a current TOTP code or one of the
+// user's recovery codes, each only once: the check and the update recording
+// the use happen atomically, and the updated user is returned.
+func (s *Service) verifySecondFactor(ctx context.Context, user *userv1.User, passcode string) (*userv1.User, error) {
+	if passcode == "" {
+		return nil, ErrSecondFactorRequired
+	}
+
+	secret, err := s.totpSecret(user)
+	if err != nil {
+		return nil, err
+	}
+
+	if step, ok := totp.ValidateStep(secret, passcode, time.Now()); ok {
+		return s.repository.Modify(ctx, user.GetId(), func(stored *userv1.User) error {
+			if stored.GetTotpSecret() != user.GetTotpSecret() {
+				return ErrWrongSecondFactor
+			}
+			return useTOTPStep(stored, step)
+		})
+	}
+
+	hash := hashRecoveryCode(passcode)
+
+	return s.repository.Modify(ctx, user.GetId(), func(stored *userv1.User) error {
+		index := slices.IndexFunc(stored.GetRecoveryCodes(), func(val string) bool {
+			return subtle.ConstantTimeCompare([]byte(val), []byte(hash)) == 1
+		})
+		if index == -1 {
+			return ErrWrongSecondFactor
+		}
+
+		stored.RecoveryCodes = slices.Delete(stored.RecoveryCodes, index, index+1)
+
+		return nil
+	})
+}
+
+func (s *Service) EnrollTOTP(ctx context.Context, id string) (string, string, error) {
+	log := applogger.FromContext(ctx, s.logger).Named("EnrollTOTP")
+	ctx, span := tracer.Start(ctx, "UsersService.EnrollTOTP", trace.WithAttributes(attribute.String("user.id", id)))
+	defer span.End()
+
+	if s.secrets == nil {
+		return "", "", errors.New("totp is not configured")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Error("Failed to generate secret", zap.Error(err))
+		return "", "", err
+	}
+
+	sealed, err := s.secrets.SealString(secret)
+	if err != nil {
+		log.Error("Failed to encrypt secret", zap.Error(err))
+		return "", "", err
+	}
+
+	user, err := s.repository.Modify(ctx, id, func(stored *userv1.User) error {
+		if stored.GetTotpEnabled() {
+			return errors.New("totp already enabled")
+		}
+
+		stored.TotpSecret = sealed
+		stored.TotpLastStep = 0
+
+		return nil
+	})
+	if err != nil {
+		log.Error("Failed to update user", zap.Error(err))
+		return "", "", err
+	}
+
+	return totp.EncodeSecret(secret), totp.URI(s.config.TOTPIssuer, user.GetUsername(), secret), nil
+}
+
+func (s *Service) ConfirmTOTP(ctx context.Context, id, code string) ([]string, error) {
+	log := applogger.FromContext(ctx, s.logger).Named("ConfirmTOTP")
+	ctx, span := tracer.Start(ctx, "UsersService.ConfirmTOTP", trace.WithAttributes(attribute.String("user.id", id)))
+	defer span.End()
+
+	user, err := s.repository.GetById(ctx, id)
+	if err != nil {
+		log.Error("Failed to get user", zap.Error(err))
+		return nil, err
+	}
+
+	if user.GetTotpEnabled() {
+		return nil, errors.New("totp already enabled")
+	}
+
+	secret, err := s.totpSecret(user)
+	if err != nil {
+		log.Error("Failed to get secret", zap.Error(err))
+		return nil, err
+	}
+
+	step, ok := totp.ValidateStep(secret, code, time.Now())
+	if !ok {
+		return nil, errors.New("wrong totp code")
+	}
+
+	recoveryCodes := make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+
+	for i := range recoveryCodes {
+		recoveryCodes[i], err = generateRecoveryCode()
+		if err != nil {
+			log.Error("Failed to generate recovery code", zap.Error(err))
+			return nil, err
+		}
+		hashes[i] = hashRecoveryCode(recoveryCodes[i])
+	}
+
+	_, err = s.repository.Modify(ctx, id, func(stored *userv1.User) error {
+		if stored.GetTotpEnabled() || stored.GetTotpSecret() != user.GetTotpSecret() {
+			return errors.New("totp enrollment changed")
+		}
+		if err := useTOTPStep(stored, step); err != nil {
+			return err
+		}
+
+		stored.TotpEnabled = true
+		stored.RecoveryCodes = hashes
+
+		return nil
+	})
+	if err != nil {
+		log.Error("Failed to update user", zap.Error(err))
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+// DisableTOTP turns the second factor off after checking code, unless
+// verified is set because the caller already passed a second factor while
+// authenticating this call. A code is only accepted once, so checking it
+// again would make the caller wait for the next one.
+func (s *Service) DisableTOTP(ctx context.Context, id, code string, verified bool) error {
+	log := applogger.FromContext(ctx, s.logger).Named("DisableTOTP")
+	ctx, span := tracer.Start(ctx, "UsersService.DisableTOTP", trace.WithAttributes(attribute.String("user.id", id)))
+	defer span.End()
+
+	user, err := s.repository.GetById(ctx, id)
+	if err != nil {
+		log.Error("Failed to get user", zap.Error(err))
+		return err
+	}
+
+	if !user.GetTotpEnabled() {
+		return errors.New("totp is not enabled")
+	}
+
+	if !verified {
+		_, err = s.verifySecondFactor(ctx, user, code)
+		if err != nil {
+			log.Error("Failed to verify second factor", zap.Error(err))
+			return err
+		}
+	}
+
+	_, err = s.repository.Modify(ctx, id, func(stored *userv1.User) error {
+		if stored.GetTotpSecret() != user.GetTotpSecret() {
+			return errors.New("totp enrollment changed")
+		}
+
+		stored.TotpEnabled = false
+		stored.TotpSecret = ""
+		stored.TotpLastStep = 0
+		stored.RecoveryCodes = nil
+		return nil
+	})
+	if err != nil {
+		log.Error("Failed to update user", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
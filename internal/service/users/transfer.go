@@ -0,0 +1,603 @@
+package users
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+
+	userv1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
+	applogger "github.com/gorobot-nz/test-task/pkg/logger"
+	"github.com/gorobot-nz/test-task/pkg/query"
+	"github.com/gorobot-nz/test-task/pkg/validation"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type Format string
+
+const (
+	FormatJSONL Format = "jsonl"
+	FormatCSV   Format = "csv"
+)
+
+type ImportMode string
+
+const (
+	ImportFailOnConflict ImportMode = "fail"
+	ImportSkip           ImportMode = "skip"
+	ImportUpsert         ImportMode = "upsert"
+)
+
+const maxImportErrors = 100
+
+// maxImportLineSize is the longest JSON lines record an import accepts.
+const maxImportLineSize = 1 << 20
+
+var ErrInvalidImport = errors.New("invalid import")
+
+// Record is a user as it appears in exports and imports. Password is only
+// read on import, as an alternative to PasswordHash. Admin and
+// EmailVerified are nil when an imported record leaves them out, so an
+// update keeps the user's current values.
+type Record struct {
+	Id            string     `json:"id,omitempty"`
+	Email         string     `json:"email"`
+	Username      string     `json:"username"`
+	Password      string     `json:"password,omitempty"`
+	PasswordHash  string     `json:"password_hash,omitempty"`
+	Admin         *bool      `json:"admin"`
+	EmailVerified *bool      `json:"email_verified"`
+	CreateTime    *time.Time `json:"create_time,omitempty"`
+}
+
+var csvColumns = []string{"id", "email", "username", "password", "password_hash", "admin", "email_verified", "create_time"}
+
+func (r *Record) csvValue(column string) string {
+	switch column {
+	case "id":
+		return r.Id
+	case "email":
+		return r.Email
+	case "username":
+		return r.Username
+	case "password":
+		return r.Password
+	case "password_hash":
+		return r.PasswordHash
+	case "admin":
+		if r.Admin != nil {
+			return strconv.FormatBool(*r.Admin)
+		}
+	case "email_verified":
+		if r.EmailVerified != nil {
+			return strconv.FormatBool(*r.EmailVerified)
+		}
+	case "create_time":
+		if r.CreateTime != nil {
+			return r.CreateTime.Format(time.RFC3339Nano)
+		}
+	}
+	return ""
+}
+
+func (r *Record) setCSVValue(column, value string) error {
+	var err error
+
+	switch column {
+	case "id":
+		r.Id = value
+	case "email":
+		r.Email = value
+	case "username":
+		r.Username = value
+	case "password":
+		r.Password = value
+	case "password_hash":
+		r.PasswordHash = value
+	case "admin":
+		r.Admin, err = parseOptionalBool(value)
+	case "email_verified":
+		r.EmailVerified, err = parseOptionalBool(value)
+	case "create_time":
+		if value != "" {
+			var t time.Time
+			t, err = time.Parse(time.RFC3339Nano, value)
+			r.CreateTime = &t
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("column %s: %w", column, err)
+	}
+	return nil
+}
+
+// parseOptionalBool parses a CSV cell, where an empty cell leaves the value
+// unset.
+func parseOptionalBool(value string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+func toRecord(user *userv1.User, includeHashes bool) *Record {
+	record := &Record{
+		Id:            user.GetId(),
+		Email:         user.GetEmail(),
+		Username:      user.GetUsername(),
+		Admin:         proto.Bool(user.GetAdmin()),
+		EmailVerified: proto.Bool(user.GetEmailVerified()),
+	}
+
+	if includeHashes {
+		record.PasswordHash = user.GetPassword()
+	}
+
+	if user.GetCreateTime() != nil {
+		t := user.GetCreateTime().AsTime()
+		record.CreateTime = &t
+	}
+
+	return record
+}
+
+// ExportUsers writes the users matching filter to w. Password hashes are
+// only written when includeHashes is set; TOTP secrets, recovery codes and
+// permissions never are.
+func (s *Service) ExportUsers(ctx context.Context, w io.Writer, format Format, filter string, includeHashes bool) error {
+	log := applogger.FromContext(ctx, s.logger).Named("ExportUsers")
+	ctx, span := tracer.Start(ctx, "UsersService.ExportUsers")
+	defer span.End()
+
+	f, err := query.ParseFilter(filter, filterFields...)
+	if err != nil {
+		return fmt.Errorf("%w: filter: %v", ErrInvalidQuery, err)
+	}
+
+	list, err := s.repository.List(ctx, -1, -1)
+	if err != nil {
+		log.Error("Failed to list users", zap.Error(err))
+		return err
+	}
+
+	columns := slices.DeleteFunc(slices.Clone(csvColumns), func(column string) bool {
+		return column == "password" || (column == "password_hash" && !includeHashes)
+	})
+
+	var csvWriter *csv.Writer
+	var encoder *json.Encoder
+
+	if format == FormatCSV {
+		csvWriter = csv.NewWriter(w)
+		if err := csvWriter.Write(columns); err != nil {
+			return err
+		}
+	} else {
+		encoder = json.NewEncoder(w)
+	}
+
+	for _, user := range list {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		ok, err := f.Match(user)
+		if err != nil {
+			return fmt.Errorf("%w: filter: %v", ErrInvalidQuery, err)
+		}
+		if !ok {
+			continue
+		}
+
+		record := toRecord(user, includeHashes)
+
+		if csvWriter == nil {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+			continue
+		}
+
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = record.csvValue(column)
+		}
+
+		if err := csvWriter.Write(row); err != nil {
+			return err
+		}
+	}
+
+	if csvWriter != nil {
+		csvWriter.Flush()
+		return csvWriter.Error()
+	}
+
+	return nil
+}
+
+type ImportOptions struct {
+	Format Format
+	Mode   ImportMode
+	DryRun bool
+}
+
+type ImportError struct {
+	Record  int
+	Message string
+}
+
+type ImportSummary struct {
+	Total   int
+	Created int
+	Updated int
+	Skipped int
+	Failed  int
+	Applied bool
+	Errors  []ImportError
+}
+
+func (s *ImportSummary) count(action importAction) {
+	if action.existing == nil {
+		s.Created++
+	} else {
+		s.Updated++
+	}
+}
+
+func (s *ImportSummary) fail(record int, err error) {
+	s.Failed++
+	if len(s.Errors) < maxImportErrors {
+		s.Errors = append(s.Errors, ImportError{Record: record, Message: err.Error()})
+	}
+}
+
+// readRecords calls fn for every record in r as soon as it's read. Records
+// that can't be parsed are counted as failed in summary and skipped.
+func readRecords(r io.Reader, format Format, summary *ImportSummary, fn func(number int, record *Record) error) error {
+	if format == FormatCSV {
+		reader := csv.NewReader(r)
+		reader.ReuseRecord = true
+
+		header, err := reader.Read()
+		if err != nil {
+			return fmt.Errorf("%w: header: %v", ErrInvalidImport, err)
+		}
+		header = slices.Clone(header)
+
+		for _, column := range header {
+			if !slices.Contains(csvColumns, column) {
+				return fmt.Errorf("%w: unknown column %q", ErrInvalidImport, column)
+			}
+		}
+
+		for number := 1; ; number++ {
+			row, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			summary.Total++
+			if err != nil {
+				var parseErr *csv.ParseError
+				if errors.As(err, &parseErr) {
+					summary.fail(number, err)
+					continue
+				}
+				return err
+			}
+
+			record := &Record{}
+			for i, column := range header {
+				if err = record.setCSVValue(column, row[i]); err != nil {
+					break
+				}
+			}
+			if err != nil {
+				summary.fail(number, err)
+				continue
+			}
+
+			if err := fn(number, record); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineSize)
+	number := 0
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		number++
+		summary.Total++
+
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.DisallowUnknownFields()
+
+		record := &Record{}
+		if err := decoder.Decode(record); err != nil {
+			summary.fail(number, err)
+			continue
+		}
+
+		if err := fn(number, record); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return fmt.Errorf("%w: record %d is longer than %d bytes", ErrInvalidImport, number+1, maxImportLineSize)
+		}
+		return err
+	}
+
+	return nil
+}
+
+type importAction struct {
+	number   int
+	record   *Record
+	existing *userv1.User
+}
+
+// ImportUsers reads records from r and creates or updates users from them.
+// Records are checked as they are read, and only the changes to make are
+// kept until the end of the import, so conflicts in fail-on-conflict mode
+// and dry runs leave the store as it was. A record that can't be written is
+// reported as failed and the rest are still written, so Created and Updated
+// only count records that made it to the store. Existing users are matched
+// by id, then username and email.
+func (s *Service) ImportUsers(ctx context.Context, r io.Reader, options ImportOptions) (*ImportSummary, error) {
+	log := applogger.FromContext(ctx, s.logger).Named("ImportUsers")
+	ctx, span := tracer.Start(ctx, "UsersService.ImportUsers")
+	defer span.End()
+
+	summary := &ImportSummary{}
+
+	list, err := s.repository.List(ctx, -1, -1)
+	if err != nil {
+		log.Error("Failed to list users", zap.Error(err))
+		return nil, err
+	}
+
+	byId := make(map[string]*userv1.User, len(list))
+	byUsername := make(map[string]*userv1.User, len(list))
+	byEmail := make(map[string]*userv1.User, len(list))
+	for _, user := range list {
+		byId[user.GetId()] = user
+		byUsername[user.GetUsername()] = user
+		byEmail[user.GetEmail()] = user
+	}
+
+	seen := make(map[string]int)
+	var actions []importAction
+
+	err = readRecords(r, options.Format, summary, func(number int, record *Record) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := s.validateRecord(record); err != nil {
+			summary.fail(number, err)
+			return nil
+		}
+
+		keys := []string{"u:" + record.Username, "e:" + record.Email}
+		if record.Id != "" {
+			keys = append(keys, "i:"+record.Id)
+		}
+
+		for _, key := range keys {
+			if previous, ok := seen[key]; ok {
+				summary.fail(number, fmt.Errorf("duplicate of record %d", previous))
+				return nil
+			}
+		}
+
+		existing, err := matchRecord(record, byId, byUsername, byEmail)
+		if err != nil {
+			summary.fail(number, err)
+			return nil
+		}
+
+		if existing == nil && record.Password == "" && record.PasswordHash == "" {
+			summary.fail(number, errors.New("new users need a password or password_hash"))
+			return nil
+		}
+
+		for _, key := range keys {
+			seen[key] = number
+		}
+
+		if existing == nil {
+			actions = append(actions, importAction{number: number, record: record})
+			return nil
+		}
+
+		switch options.Mode {
+		case ImportSkip:
+			summary.Skipped++
+		case ImportUpsert:
+			actions = append(actions, importAction{number: number, record: record, existing: existing})
+		default:
+			summary.fail(number, fmt.Errorf("conflicts with user %s", existing.GetId()))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if options.DryRun || (options.Mode != ImportSkip && options.Mode != ImportUpsert && summary.Failed > 0) {
+		for _, action := range actions {
+			summary.count(action)
+		}
+		return summary, nil
+	}
+
+	summary.Applied = true
+
+	for _, action := range actions {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if err := s.applyRecord(ctx, log, action); err != nil {
+			summary.fail(action.number, err)
+			continue
+		}
+
+		summary.count(action)
+	}
+
+	return summary, nil
+}
+
+func (s *Service) validateRecord(record *Record) error {
+	if !validation.IsValidEmail(record.Email) {
+		return errors.New("failure mail validation")
+	}
+
+	if !validation.IsValidUsername(record.Username) {
+		return errors.New("failure username validation")
+	}
+
+	if record.Password != "" && record.PasswordHash != "" {
+		return errors.New("password and password_hash are mutually exclusive")
+	}
+
+	if record.Password != "" && !validation.IsValidPassword(record.Password) {
+		return errors.New("failure password validation")
+	}
+
+	if record.PasswordHash != "" {
+		if err := s.hasher.Validate(record.PasswordHash); err != nil {
+			return fmt.Errorf("password_hash: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func matchRecord(record *Record, byId, byUsername, byEmail map[string]*userv1.User) (*userv1.User, error) {
+	usernameOwner, emailOwner := byUsername[record.Username], byEmail[record.Email]
+
+	existing := byId[record.Id]
+	if existing == nil {
+		existing = usernameOwner
+		if existing == nil {
+			existing = emailOwner
+		}
+
+		if existing != nil && record.Id != "" {
+			return nil, fmt.Errorf("username or email belongs to user %s", existing.GetId())
+		}
+	}
+
+	if existing == nil {
+		return nil, nil
+	}
+
+	if (usernameOwner != nil && usernameOwner != existing) || (emailOwner != nil && emailOwner != existing) {
+		return nil, errors.New("username and email belong to different users")
+	}
+
+	return existing, nil
+}
+
+func (s *Service) applyRecord(ctx context.Context, log *zap.Logger, action importAction) error {
+	record := action.record
+
+	password := record.PasswordHash
+	if record.Password != "" {
+		var err error
+		password, err = s.hasher.Hash(record.Password)
+		if err != nil {
+			log.Error("Failed to generate password", zap.Error(err))
+			return err
+		}
+	}
+
+	if action.existing != nil {
+		// Only what the record sets is changed, on the user as it's stored
+		// now rather than as it was when the record was matched.
+		_, err := s.repository.Modify(ctx, action.existing.GetId(), func(stored *userv1.User) error {
+			if stored.GetEmail() != record.Email {
+				stored.EmailVerified = false
+			}
+
+			stored.Email = record.Email
+			stored.Username = record.Username
+			if record.Admin != nil {
+				stored.Admin = *record.Admin
+			}
+			if record.EmailVerified != nil {
+				stored.EmailVerified = *record.EmailVerified
+			}
+			if password != "" {
+				stored.Password = password
+			}
+
+			return nil
+		})
+		if err != nil {
+			log.Error("Failed to update user", zap.Error(err))
+			return err
+		}
+
+		return nil
+	}
+
+	user := &userv1.User{
+		Id:            record.Id,
+		Email:         record.Email,
+		Username:      record.Username,
+		Password:      password,
+		Admin:         record.Admin != nil && *record.Admin,
+		EmailVerified: record.EmailVerified != nil && *record.EmailVerified,
+	}
+
+	if record.CreateTime != nil {
+		user.CreateTime = timestamppb.New(*record.CreateTime)
+	}
+
+	id, err := s.repository.Create(ctx, user)
+	if err != nil {
+		log.Error("Failed to create user", zap.Error(err))
+		return err
+	}
+
+	if !user.GetEmailVerified() {
+		err = s.sendVerification(ctx, log, id, user.GetEmail())
+		if err != nil {
+			log.Error("Failed to send verification", zap.Error(err))
+		}
+	}
+
+	return nil
+}
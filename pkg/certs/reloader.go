@@ -0,0 +1,150 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type Reloader struct {
+	m sync.RWMutex
+
+	certFile string
+	keyFile  string
+	caFile   string
+
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+	modTimes map[string]time.Time
+
+	logger *zap.Logger
+}
+
+func NewReloader(logger *zap.Logger, certFile, keyFile, caFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		modTimes: make(map[string]time.Time),
+		logger:   logger,
+	}
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.caFile != "" {
+		files = append(files, r.caFile)
+	}
+	return files
+}
+
+func (r *Reloader) reload() error {
+	modTimes := make(map[string]time.Time)
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates in client CA file")
+		}
+	}
+
+	r.m.Lock()
+	r.cert = &cert
+	r.pool = pool
+	r.modTimes = modTimes
+	r.m.Unlock()
+
+	return nil
+}
+
+func (r *Reloader) changed() bool {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if !info.ModTime().Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Watch polls the certificate files and reloads them when any of them
+// changes. A broken update is logged and the previous certificate stays in
+// use. It returns when stop is closed.
+func (r *Reloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	log := r.logger.Named("Watch")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+
+			if err := r.reload(); err != nil {
+				log.Error("Failed to reload certificates", zap.Error(err))
+				continue
+			}
+
+			log.Info("Certificates reloaded")
+		}
+	}
+}
+
+func (r *Reloader) TLSConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.m.RLock()
+			defer r.m.RUnlock()
+
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientCAs:    r.pool,
+				ClientAuth:   clientAuth,
+				NextProtos:   []string{"h2"},
+			}, nil
+		},
+	}
+}
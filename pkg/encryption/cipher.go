@@ -0,0 +1,75 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+)
+
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+func NewCipher(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cipher{
+		aead: aead,
+	}, nil
+}
+
+func (c *Cipher) Seal(plaintext []byte) ([]byte, error) {
+	return c.SealWithData(plaintext, nil)
+}
+
+func (c *Cipher) Open(ciphertext []byte) ([]byte, error) {
+	return c.OpenWithData(ciphertext, nil)
+}
+
+// SealWithData seals plaintext bound to additionalData, which isn't
+// encrypted but must be passed to OpenWithData unchanged.
+func (c *Cipher) SealWithData(plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return c.aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func (c *Cipher) OpenWithData(ciphertext, additionalData []byte) ([]byte, error) {
+	size := c.aead.NonceSize()
+	if len(ciphertext) < size {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	return c.aead.Open(nil, ciphertext[:size], ciphertext[size:], additionalData)
+}
+
+func (c *Cipher) SealString(plaintext []byte) (string, error) {
+	sealed, err := c.Seal(plaintext)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *Cipher) OpenString(ciphertext string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Open(sealed)
+}
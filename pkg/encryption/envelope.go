@@ -0,0 +1,133 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var envelopeMagic = []byte("TTENC1\n")
+
+type envelopeHeader struct {
+	KeyId      string `json:"kid"`
+	WrappedKey []byte `json:"dek"`
+}
+
+// envelopeData is what both the wrapped data key and the ciphertext are
+// bound to, so neither opens as another store's or under another key id.
+func envelopeData(store, keyId string) []byte {
+	return []byte(fmt.Sprintf("%s%q %q", envelopeMagic, store, keyId))
+}
+
+// SealEnvelope encrypts data of the named store under a fresh data key and
+// stores that key, wrapped by the keyring's current master key, in a header
+// in front of the ciphertext. Only the small header depends on the master
+// key, so rotating it never requires more than rewriting the file once.
+func SealEnvelope(keyring *Keyring, store string, data []byte) ([]byte, error) {
+	keyId := keyring.Current()
+	additionalData := envelopeData(store, keyId)
+
+	master, err := keyring.get(keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	wrapped, err := master.SealWithData(dataKey, additionalData)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := json.Marshal(&envelopeHeader{
+		KeyId:      keyId,
+		WrappedKey: wrapped,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := c.SealWithData(data, additionalData)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.Write(envelopeMagic)
+	b.Write(header)
+	b.WriteByte('\n')
+	b.Write(sealed)
+
+	return b.Bytes(), nil
+}
+
+func IsEnvelope(data []byte) bool {
+	return bytes.HasPrefix(data, envelopeMagic)
+}
+
+// EnvelopeKeyId returns the id of the master key an envelope was sealed
+// with.
+func EnvelopeKeyId(data []byte) (string, error) {
+	header, _, err := splitEnvelope(data)
+	if err != nil {
+		return "", err
+	}
+	return header.KeyId, nil
+}
+
+// OpenEnvelope decrypts an envelope sealed for the named store. It fails if
+// the envelope was sealed for another store or was tampered with.
+func OpenEnvelope(keyring *Keyring, store string, data []byte) ([]byte, error) {
+	header, sealed, err := splitEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	additionalData := envelopeData(store, header.KeyId)
+
+	master, err := keyring.get(header.KeyId)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := master.OpenWithData(header.WrappedKey, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+
+	c, err := NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.OpenWithData(sealed, additionalData)
+}
+
+func splitEnvelope(data []byte) (*envelopeHeader, []byte, error) {
+	if !IsEnvelope(data) {
+		return nil, nil, errors.New("not an encrypted envelope")
+	}
+
+	rest := data[len(envelopeMagic):]
+
+	line, sealed, ok := bytes.Cut(rest, []byte("\n"))
+	if !ok {
+		return nil, nil, errors.New("truncated envelope header")
+	}
+
+	var header envelopeHeader
+	if err := json.Unmarshal(line, &header); err != nil {
+		return nil, nil, err
+	}
+
+	return &header, sealed, nil
+}
@@ -0,0 +1,141 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testKeyring loads a keyring with a key per id, each 32 bytes of the id's
+// first letter. The last id is the current key.
+func testKeyring(t *testing.T, ids ...string) *Keyring {
+	t.Helper()
+
+	var lines []string
+	for _, id := range ids {
+		key := bytes.Repeat([]byte(id[:1]), 32)
+		lines = append(lines, id+":"+base64.StdEncoding.EncodeToString(key))
+	}
+
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := LoadKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keyring
+}
+
+// withHeader rewrites the header of an envelope.
+func withHeader(t *testing.T, envelope []byte, change func(header *envelopeHeader)) []byte {
+	t.Helper()
+
+	header, sealed, err := splitEnvelope(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change(header)
+
+	line, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return append(append(append(append([]byte{}, envelopeMagic...), line...), '\n'), sealed...)
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	data := []byte(`{"id":"1","username":"alice"}` + "\n")
+
+	sealed, err := SealEnvelope(testKeyring(t, "old"), "users", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsEnvelope(sealed) {
+		t.Fatal("Sealed data isn't an envelope")
+	}
+	if bytes.Contains(sealed, []byte("alice")) {
+		t.Error("Envelope contains the plaintext")
+	}
+	if id, err := EnvelopeKeyId(sealed); err != nil || id != "old" {
+		t.Errorf("Key id is %q, %v, want old", id, err)
+	}
+
+	// Keys stay usable after a rotation appends a new one.
+	opened, err := OpenEnvelope(testKeyring(t, "old", "new"), "users", sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, data) {
+		t.Errorf("Opened %q, want %q", opened, data)
+	}
+}
+
+func TestOpenEnvelopeErrors(t *testing.T) {
+	// next and new share a key, so only the key id tells them apart.
+	keyring := testKeyring(t, "old", "next", "new")
+
+	sealed, err := SealEnvelope(keyring, "users", []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		keyring  *Keyring
+		store    string
+		envelope []byte
+	}{
+		{"other store", keyring, "api_keys", sealed},
+		{"unknown key", testKeyring(t, "other"), "users", sealed},
+		{"flipped ciphertext", keyring, "users", append(sealed[:len(sealed)-1:len(sealed)-1], sealed[len(sealed)-1]^1)},
+		{"flipped data key", keyring, "users", withHeader(t, sealed, func(header *envelopeHeader) {
+			header.WrappedKey[len(header.WrappedKey)-1] ^= 1
+		})},
+		{"other key id", keyring, "users", withHeader(t, sealed, func(header *envelopeHeader) {
+			header.KeyId = "next"
+		})},
+		{"truncated header", keyring, "users", sealed[:len(envelopeMagic)+5]},
+		{"plaintext", keyring, "users", []byte("data")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := OpenEnvelope(tt.keyring, tt.store, tt.envelope); err == nil {
+				t.Error("Opened the envelope")
+			}
+		})
+	}
+}
+
+func TestFileRoundTrip(t *testing.T) {
+	keyring := testKeyring(t, "old")
+	path := filepath.Join(t.TempDir(), "users_store.txt")
+	data := []byte("data")
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReadFile(keyring, "users", path); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Read plaintext %q, %v, want %q", got, err, data)
+	}
+
+	if err := WriteFile(keyring, "users", path, data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(nil, "users", path); err == nil {
+		t.Error("Read an encrypted file without keys")
+	}
+	if got, err := ReadFile(keyring, "users", path); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Read %q, %v, want %q", got, err, data)
+	}
+}
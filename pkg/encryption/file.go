@@ -0,0 +1,63 @@
+package encryption
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ReadFile reads the named store from a file written by WriteFile.
+// Plaintext files are returned as is so stores written before encryption
+// was enabled keep loading.
+func ReadFile(keyring *Keyring, store, path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !IsEnvelope(data) {
+		return data, nil
+	}
+
+	if keyring == nil {
+		return nil, errors.New("file is encrypted but no key file is configured")
+	}
+
+	return OpenEnvelope(keyring, store, data)
+}
+
+// WriteFile replaces path with the named store's data, sealed under the
+// keyring's current key when a keyring is given. The file is written next
+// to the target and renamed into place so a crash never leaves a
+// half-written store behind.
+func WriteFile(keyring *Keyring, store, path string, data []byte) error {
+	if keyring != nil {
+		sealed, err := SealEnvelope(keyring, store, data)
+		if err != nil {
+			return err
+		}
+		data = sealed
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,90 @@
+package encryption
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Keyring holds master keys read from a key file with one
+// "id:base64-key" pair per line. The last key is the current one: rotating
+// means appending a new line while keeping the old ones until nothing is
+// encrypted under them anymore.
+type Keyring struct {
+	current string
+	keys    map[string]*Cipher
+}
+
+func LoadKeyring(path string) (*Keyring, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keyring := &Keyring{
+		keys: make(map[string]*Cipher),
+	}
+
+	scanner := bufio.NewScanner(file)
+	number := 0
+
+	for scanner.Scan() {
+		number++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		id, value, ok := strings.Cut(line, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("malformed key on line %d", number)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %q must be 32 bytes", id)
+		}
+
+		if _, ok := keyring.keys[id]; ok {
+			return nil, fmt.Errorf("duplicate key %q", id)
+		}
+
+		c, err := NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+
+		keyring.keys[id] = c
+		keyring.current = id
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if keyring.current == "" {
+		return nil, errors.New("no keys in key file")
+	}
+
+	return keyring, nil
+}
+
+func (k *Keyring) Current() string {
+	return k.current
+}
+
+func (k *Keyring) get(id string) (*Cipher, error) {
+	c, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	return c, nil
+}
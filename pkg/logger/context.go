@@ -0,0 +1,29 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// noLogger is what ctxzap returns for a context without a request logger.
+var noLogger = ctxzap.Extract(context.Background())
+
+// FromContext returns the request-scoped logger stored in ctx by the gRPC
+// logging interceptor, named like base. Outside of a request it returns
+// base.
+func FromContext(ctx context.Context, base *zap.Logger) *zap.Logger {
+	logger := ctxzap.Extract(ctx)
+	if logger == noLogger {
+		return base
+	}
+
+	return logger.Named(base.Name())
+}
+
+// AddFields adds fields to the request-scoped logger in ctx, and to the
+// line logged when the call finishes.
+func AddFields(ctx context.Context, fields ...zap.Field) {
+	ctxzap.AddFields(ctx, fields...)
+}
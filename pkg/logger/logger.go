@@ -1,21 +1,115 @@
 package logger
 
 import (
+	"fmt"
+	"os"
+	"time"
+
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"os"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-func NewLogger(level zapcore.Level) *zap.Logger {
-	atom := zap.NewAtomicLevel()
-	atom.SetLevel(level)
+type Format string
+
+const (
+	JSON    Format = "json"
+	Console Format = "console"
+)
+
+type Config struct {
+	// Level can be changed while the logger is in use.
+	Level  zap.AtomicLevel
+	Format Format
+
+	// File is written instead of stdout when set. It's rotated when it grows
+	// past MaxSize megabytes (100 when 0) and, if RotateInterval is set, on
+	// that interval. Rotated files are removed once there are more than
+	// MaxBackups of them or they are older than MaxAge, whichever is set.
+	File           string
+	MaxSize        int
+	MaxBackups     int
+	MaxAge         time.Duration
+	RotateInterval time.Duration
+	Compress       bool
+
+	// Within each second, only the first SampleInitial entries with the same
+	// level and message are logged, then every SampleThereafter-th. Sampling
+	// is off when SampleThereafter is 0.
+	SampleInitial    int
+	SampleThereafter int
+}
 
+// NewLogger builds a logger from config. The returned function closes the log
+// file.
+func NewLogger(config Config) (*zap.Logger, func() error, error) {
 	encoderCfg := zap.NewProductionEncoderConfig()
 	encoderCfg.EncodeTime = zapcore.ISO8601TimeEncoder
 
-	return zap.New(zapcore.NewCore(
-		zapcore.NewJSONEncoder(encoderCfg),
-		zapcore.Lock(os.Stdout),
-		atom,
-	))
+	var encoder zapcore.Encoder
+	switch config.Format {
+	case "", JSON:
+		encoder = zapcore.NewJSONEncoder(encoderCfg)
+	case Console:
+		encoderCfg.EncodeLevel = zapcore.CapitalLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(encoderCfg)
+	default:
+		return nil, nil, fmt.Errorf("unknown log format %q", config.Format)
+	}
+
+	var (
+		output zapcore.WriteSyncer
+		closer func() error
+	)
+	if config.File == "" {
+		output = zapcore.Lock(os.Stdout)
+		closer = func() error { return nil }
+	} else {
+		file := &lumberjack.Logger{
+			Filename:   config.File,
+			MaxSize:    config.MaxSize,
+			MaxBackups: config.MaxBackups,
+			MaxAge:     int((config.MaxAge + 24*time.Hour - 1) / (24 * time.Hour)),
+			Compress:   config.Compress,
+		}
+		output = zapcore.AddSync(file)
+		closer = file.Close
+
+		if config.RotateInterval > 0 {
+			closer = rotateEvery(file, config.RotateInterval)
+		}
+	}
+
+	core := zapcore.NewCore(encoder, output, config.Level)
+	if config.SampleThereafter > 0 {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, config.SampleInitial, config.SampleThereafter)
+	}
+
+	return zap.New(core), closer, nil
+}
+
+// rotateEvery rotates file on every tick of interval until the returned
+// function is called.
+func rotateEvery(file *lumberjack.Logger, interval time.Duration) func() error {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := file.Rotate(); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to rotate log file: %v\n", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() error {
+		ticker.Stop()
+		close(done)
+		return file.Close()
+	}
 }
@@ -0,0 +1,125 @@
+package logger
+
+import (
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Redacted replaces the value of sensitive string fields in logged messages.
+// Other sensitive fields are left out.
+const Redacted = "[REDACTED]"
+
+var redaction redactor
+
+type redactor struct {
+	option protoreflect.ExtensionType
+	fields map[string]struct{}
+}
+
+// SetRedaction sets which fields of messages logged with Proto are masked:
+// fields with the bool option set to true, and fields whose name or full
+// name is listed in fields.
+func SetRedaction(option protoreflect.ExtensionType, fields []string) {
+	names := make(map[string]struct{}, len(fields))
+	for _, field := range fields {
+		names[field] = struct{}{}
+	}
+
+	redaction = redactor{option: option, fields: names}
+}
+
+// Proto logs msg as JSON with its sensitive fields masked. The message is
+// only copied and encoded if the entry is written.
+func Proto(key string, msg proto.Message) zap.Field {
+	return zap.Any(key, redactedMessage{msg: msg, redactor: redaction})
+}
+
+type redactedMessage struct {
+	msg      proto.Message
+	redactor redactor
+}
+
+func (m redactedMessage) MarshalJSON() ([]byte, error) {
+	if m.msg == nil || !m.msg.ProtoReflect().IsValid() {
+		return []byte("null"), nil
+	}
+
+	msg := proto.Clone(m.msg)
+	m.redactor.redact(msg.ProtoReflect())
+
+	return protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+}
+
+func (r redactor) sensitive(fd protoreflect.FieldDescriptor) bool {
+	if _, ok := r.fields[string(fd.Name())]; ok {
+		return true
+	}
+	if _, ok := r.fields[string(fd.FullName())]; ok {
+		return true
+	}
+	if r.option == nil {
+		return false
+	}
+
+	sensitive, _ := proto.GetExtension(fd.Options(), r.option).(bool)
+	return sensitive
+}
+
+func (r redactor) redact(m protoreflect.Message) {
+	var fields []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, fd)
+		return true
+	})
+
+	for _, fd := range fields {
+		value := m.Get(fd)
+
+		switch {
+		case r.sensitive(fd):
+			r.mask(m, fd, value)
+		case fd.IsMap():
+			if fd.MapValue().Message() != nil {
+				value.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+					r.redact(v.Message())
+					return true
+				})
+			}
+		case fd.IsList():
+			if fd.Message() != nil {
+				for i := 0; i < value.List().Len(); i++ {
+					r.redact(value.List().Get(i).Message())
+				}
+			}
+		case fd.Message() != nil:
+			r.redact(value.Message())
+		}
+	}
+}
+
+func (r redactor) mask(m protoreflect.Message, fd protoreflect.FieldDescriptor, value protoreflect.Value) {
+	redacted := protoreflect.ValueOfString(Redacted)
+
+	switch {
+	case fd.IsMap():
+		if fd.MapValue().Kind() != protoreflect.StringKind {
+			m.Clear(fd)
+			return
+		}
+
+		value.Map().Range(func(key protoreflect.MapKey, _ protoreflect.Value) bool {
+			value.Map().Set(key, redacted)
+			return true
+		})
+	case fd.Kind() != protoreflect.StringKind:
+		m.Clear(fd)
+	case fd.IsList():
+		for i := 0; i < value.List().Len(); i++ {
+			value.List().Set(i, redacted)
+		}
+	default:
+		m.Set(fd, redacted)
+	}
+}
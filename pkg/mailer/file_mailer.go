@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+type FileMailer struct {
+	m sync.Mutex
+
+	path string
+}
+
+func NewFileMailer(path string) *FileMailer {
+	return &FileMailer{
+		path: path,
+	}
+}
+
+func (f *FileMailer) Send(ctx context.Context, message Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	marshal, err := json.Marshal(&message)
+	if err != nil {
+		return err
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.WriteString(fmt.Sprintf("%s\n", string(marshal)))
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+type MemoryMailer struct {
+	m sync.Mutex
+
+	messages []Message
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(ctx context.Context, message Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.m.Lock()
+	m.messages = append(m.messages, message)
+	m.m.Unlock()
+
+	return nil
+}
+
+func (m *MemoryMailer) Messages() []Message {
+	m.m.Lock()
+	messages := slices.Clone(m.messages)
+	m.m.Unlock()
+
+	return messages
+}
@@ -0,0 +1,78 @@
+package memlistener
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+// Network is reported by the addresses of connections made through a
+// Listener, so servers can tell in-process clients from remote ones.
+const Network = "memory"
+
+type addr struct{}
+
+func (addr) Network() string { return Network }
+func (addr) String() string  { return Network }
+
+type conn struct {
+	net.Conn
+}
+
+func (conn) LocalAddr() net.Addr  { return addr{} }
+func (conn) RemoteAddr() net.Addr { return addr{} }
+
+// Listener is a net.Listener for clients in the same process, connected
+// with DialContext instead of over the network.
+type Listener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func New() *Listener {
+	return &Listener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *Listener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	return nil
+}
+
+func (l *Listener) Addr() net.Addr {
+	return addr{}
+}
+
+// DialContext connects to the listener. The address is ignored so it can
+// be passed as a dialer for any target.
+func (l *Listener) DialContext(ctx context.Context, _ string) (net.Conn, error) {
+	server, client := net.Pipe()
+
+	select {
+	case l.conns <- conn{server}:
+		return conn{client}, nil
+	case <-l.done:
+		server.Close()
+		client.Close()
+		return nil, errors.New("listener closed")
+	case <-ctx.Done():
+		server.Close()
+		client.Close()
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric of the service along with the Go runtime and
+// process collectors.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	RPCHandled = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "RPCs completed on the server, by method and status code.",
+	}, []string{"grpc_type", "grpc_service", "grpc_method", "grpc_code"})
+
+	RPCDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Time taken to complete RPCs on the server.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"grpc_type", "grpc_service", "grpc_method"})
+
+	StorageItems = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "storage_items",
+		Help: "Number of items held by a storage.",
+	}, []string{"storage"})
+
+	StorageOperationDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "storage_operation_duration_seconds",
+		Help:    "Time taken by storage operations, including waiting for the lock.",
+		Buckets: prometheus.ExponentialBuckets(0.000001, 4, 10),
+	}, []string{"storage", "operation"})
+
+	PasswordHashDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "password_hash_duration_seconds",
+		Help:    "Time taken to hash or verify a password.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 12),
+	}, []string{"algorithm", "operation"})
+
+	AuthFailures = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_failures_total",
+		Help: "Rejected authentication attempts, by reason.",
+	}, []string{"reason"})
+
+	SnapshotDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "snapshot_duration_seconds",
+		Help:    "Time taken to write a store snapshot to disk.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"store"})
+
+	SnapshotFailures = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "snapshot_failures_total",
+		Help: "Store snapshots that failed to be written.",
+	}, []string{"store"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -3,49 +3,325 @@ package middleware
 import (
 	"context"
 	"encoding/base64"
+	"fmt"
 	userv1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
+	applogger "github.com/gorobot-nz/test-task/pkg/logger"
+	"github.com/gorobot-nz/test-task/pkg/memlistener"
+	"github.com/gorobot-nz/test-task/pkg/metrics"
+	grpcmiddleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpcauth "github.com/grpc-ecosystem/go-grpc-middleware/auth"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"math"
+	"net"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var adminOnlyMethods = []string{
 	userv1.UserService_NewUser_FullMethodName,
 	userv1.UserService_DeleteUser_FullMethodName,
 	userv1.UserService_UpdateUser_FullMethodName,
+	userv1.UserService_CreateApiKey_FullMethodName,
+	userv1.UserService_ListApiKeys_FullMethodName,
+	userv1.UserService_RevokeApiKey_FullMethodName,
+	userv1.UserService_ListLockouts_FullMethodName,
+	userv1.UserService_ClearLockout_FullMethodName,
+	userv1.UserService_BatchCreateUsers_FullMethodName,
+	userv1.UserService_BatchDeleteUsers_FullMethodName,
+	userv1.UserService_ExportUsers_FullMethodName,
+	userv1.UserService_ImportUsers_FullMethodName,
+}
+
+var selfServiceMethods = []string{
+	userv1.UserService_GetMe_FullMethodName,
+	userv1.UserService_UpdateMe_FullMethodName,
+	userv1.UserService_ChangePassword_FullMethodName,
+	userv1.UserService_EnrollTOTP_FullMethodName,
+	userv1.UserService_ConfirmTOTP_FullMethodName,
+	userv1.UserService_DisableTOTP_FullMethodName,
 }
 
 const Username = "username"
 const Password = "password"
+const TOTPCode = "totp_code"
+const ApiKey = "api_key"
+const CertPrincipal = "cert_principal"
+
+type CertIdentity string
+
+const (
+	CertIdentityNone       CertIdentity = ""
+	CertIdentityCommonName CertIdentity = "cn"
+	CertIdentityEmail      CertIdentity = "san-email"
+	CertIdentityDNS        CertIdentity = "san-dns"
+	CertIdentityURI        CertIdentity = "san-uri"
+)
+
+func ParseCertIdentity(s string) (CertIdentity, error) {
+	switch identity := CertIdentity(s); identity {
+	case CertIdentityNone, CertIdentityCommonName, CertIdentityEmail, CertIdentityDNS, CertIdentityURI:
+		return identity, nil
+	default:
+		return "", fmt.Errorf("unknown certificate identity %q", s)
+	}
+}
+
+// certPrincipal maps a verified client certificate to the username it
+// authenticates as. Unverified certificates never map to a principal.
+func certPrincipal(ctx context.Context, identity CertIdentity) (string, bool) {
+	if identity == CertIdentityNone {
+		return "", false
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+
+	cert := tlsInfo.State.VerifiedChains[0][0]
+
+	switch identity {
+	case CertIdentityCommonName:
+		return cert.Subject.CommonName, cert.Subject.CommonName != ""
+	case CertIdentityEmail:
+		if len(cert.EmailAddresses) > 0 {
+			return cert.EmailAddresses[0], true
+		}
+	case CertIdentityDNS:
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0], true
+		}
+	case CertIdentityURI:
+		if len(cert.URIs) > 0 {
+			return cert.URIs[0].String(), true
+		}
+	}
+
+	return "", false
+}
 
-func AuthMiddleware() grpc.UnaryServerInterceptor {
+const (
+	ScopeUsersRead  = "users.read"
+	ScopeUsersWrite = "users.write"
+)
+
+// methodScopes lists the methods an API key may call and the scope it needs
+// for each. Keys manage ordinary users only. Credential management is left
+// out on purpose: changing a password, second factor or API keys always
+// requires the owner's password. So is ImportUsers, whose records carry
+// password hashes and admin flags. The handlers refuse the rest of what
+// would let a key make or take over an admin: creating admins, and updating
+// passwords, admin flags, permissions or admins themselves with UpdateUser.
+var methodScopes = map[string]string{
+	userv1.UserService_GetMe_FullMethodName:      ScopeUsersRead,
+	userv1.UserService_NewUser_FullMethodName:    ScopeUsersWrite,
+	userv1.UserService_UpdateUser_FullMethodName: ScopeUsersWrite,
+	userv1.UserService_DeleteUser_FullMethodName: ScopeUsersWrite,
+	userv1.UserService_UpdateMe_FullMethodName:   ScopeUsersWrite,
+
+	userv1.UserService_BatchCreateUsers_FullMethodName: ScopeUsersWrite,
+	userv1.UserService_BatchDeleteUsers_FullMethodName: ScopeUsersWrite,
+	userv1.UserService_ExportUsers_FullMethodName:      ScopeUsersRead,
+}
+
+func IsKnownScope(scope string) bool {
+	return scope == ScopeUsersRead || scope == ScopeUsersWrite
+}
+
+func ScopeAllows(scopes []string, fullMethod string) bool {
+	scope, ok := methodScopes[fullMethod]
+	if !ok {
+		return false
+	}
+	return slices.Contains(scopes, scope)
+}
+
+const totpCodeHeader = "x-totp-code"
+const retryAfterHeader = "retry-after"
+const forwardedForHeader = "x-forwarded-for"
+
+// peerAddress returns the host the request came from. Requests relayed by
+// the in-process HTTP gateway come from the client address the gateway
+// appended to x-forwarded-for; entries before it are client-supplied.
+func peerAddress(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	if p.Addr.Network() == memlistener.Network {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get(forwardedForHeader); len(values) > 0 {
+			hosts := strings.Split(values[len(values)-1], ",")
+			return strings.TrimSpace(hosts[len(hosts)-1])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+func retryAfterSeconds(retryAfter time.Duration) int {
+	return int(math.Ceil(retryAfter.Seconds()))
+}
+
+// guard runs the handler while tracking whether the credentials it verified
+// were wrong, and refuses to run it at all while the account or peer is
+// locked out.
+func guard(ctx context.Context, lockouts *LockoutTracker, account string, run func(ctx context.Context) error) error {
+	if lockouts == nil {
+		return run(ctx)
+	}
+
+	address := peerAddress(ctx)
+
+	if retryAfter, locked := lockouts.Locked(account, address); locked {
+		metrics.AuthFailures.WithLabelValues("locked_out").Inc()
+		seconds := retryAfterSeconds(retryAfter)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(retryAfterHeader, strconv.Itoa(seconds)))
+		return status.Error(codes.ResourceExhausted, fmt.Sprintf("Too many failed attempts, retry in %ds", seconds))
+	}
+
+	attempt := ctx.Value(authAttemptKey{}).(*authAttempt)
+	err := run(ctx)
+
+	attempt.m.Lock()
+	reported, succeeded := attempt.reported, attempt.succeeded
+	attempt.m.Unlock()
+
+	if reported && succeeded && account != "" {
+		lockouts.Success(account)
+	}
+	if reported && !succeeded {
+		lockouts.Failure(account, address)
+	}
+
+	return err
+}
+
+func isProtected(fullMethod string) bool {
+	return slices.Contains(adminOnlyMethods, fullMethod) || slices.Contains(selfServiceMethods, fullMethod)
+}
+
+// withCredentials stores the caller's credentials in the context for the
+// handler to verify. It returns the account they claim, and whether the
+// attempt goes through the lockout tracker: certificates were already
+// verified during the handshake, so they don't.
+//
+// An Authorization header always wins: a valid client certificate is
+// ignored whenever the call also carries an API key or Basic credentials,
+// even wrong ones. Certificates only identify callers of the gRPC listener
+// itself; calls relayed by the REST gateway or Connect arrive over the
+// in-memory listener without one.
+func withCredentials(ctx context.Context, certIdentity CertIdentity) (context.Context, string, bool, error) {
+	if key, err := grpcauth.AuthFromMD(ctx, "apikey"); err == nil {
+		applogger.AddFields(ctx, zap.String("principal", "apikey"))
+		return context.WithValue(ctx, ApiKey, key), "", true, nil
+	}
+
+	token, err := grpcauth.AuthFromMD(ctx, "basic")
+	if err != nil {
+		if principal, ok := certPrincipal(ctx, certIdentity); ok {
+			applogger.AddFields(ctx, zap.String("principal", principal))
+			return context.WithValue(ctx, CertPrincipal, principal), "", false, nil
+		}
+		metrics.AuthFailures.WithLabelValues("missing_credentials").Inc()
+		return nil, "", false, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	decodeString, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		metrics.AuthFailures.WithLabelValues("malformed_credentials").Inc()
+		return nil, "", false, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	split := strings.SplitN(string(decodeString), ":", 2)
+
+	if len(split) != 2 {
+		metrics.AuthFailures.WithLabelValues("malformed_credentials").Inc()
+		return nil, "", false, status.Error(codes.PermissionDenied, "Malformed basic credentials")
+	}
+
+	ctx = context.WithValue(ctx, Username, split[0])
+	ctx = context.WithValue(ctx, Password, split[1])
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(totpCodeHeader); len(values) > 0 {
+			ctx = context.WithValue(ctx, TOTPCode, values[0])
+		}
+	}
+
+	applogger.AddFields(ctx, zap.String("principal", split[0]))
+
+	return ctx, split[0], true, nil
+}
+
+func AuthMiddleware(certIdentity CertIdentity, lockouts *LockoutTracker) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
-		if !slices.Contains(adminOnlyMethods, info.FullMethod) {
+		if !isProtected(info.FullMethod) {
 			return handler(ctx, req)
 		}
 
-		token, err := grpcauth.AuthFromMD(ctx, "basic")
+		ctx, account, guarded, err := withCredentials(ctx, certIdentity)
 		if err != nil {
-			return nil, status.Error(codes.PermissionDenied, err.Error())
+			return nil, err
 		}
+		ctx = context.WithValue(ctx, authAttemptKey{}, &authAttempt{})
 
-		decodeString, err := base64.StdEncoding.DecodeString(token)
-		if err != nil {
-			return nil, status.Error(codes.PermissionDenied, err.Error())
+		if !guarded {
+			return handler(ctx, req)
 		}
 
-		split := strings.SplitN(string(decodeString), ":", 2)
+		var resp any
+		err = guard(ctx, lockouts, account, func(ctx context.Context) error {
+			var err error
+			resp, err = handler(ctx, req)
+			return err
+		})
+
+		return resp, err
+	}
+}
+
+func StreamAuthMiddleware(certIdentity CertIdentity, lockouts *LockoutTracker) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !isProtected(info.FullMethod) {
+			return handler(srv, ss)
+		}
 
-		if len(split) != 2 {
-			return nil, status.Error(codes.PermissionDenied, err.Error())
+		ctx, account, guarded, err := withCredentials(ss.Context(), certIdentity)
+		if err != nil {
+			return err
 		}
+		ctx = context.WithValue(ctx, authAttemptKey{}, &authAttempt{})
 
-		ctx = context.WithValue(ctx, Username, split[0])
-		ctx = context.WithValue(ctx, Password, split[1])
+		wrapped := grpcmiddleware.WrapServerStream(ss)
+		wrapped.WrappedContext = ctx
+
+		if !guarded {
+			return handler(srv, wrapped)
+		}
 
-		return handler(ctx, req)
+		return guard(ctx, lockouts, account, func(ctx context.Context) error {
+			wrapped.WrappedContext = ctx
+			return handler(srv, wrapped)
+		})
 	}
 }
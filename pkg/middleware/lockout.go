@@ -0,0 +1,333 @@
+package middleware
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LockoutKind string
+
+const (
+	LockoutAccount LockoutKind = "account"
+	LockoutPeer    LockoutKind = "peer"
+)
+
+type LockoutConfig struct {
+	AccountThreshold int
+	PeerThreshold    int
+	BaseDuration     time.Duration
+	MaxDuration      time.Duration
+	ResetAfter       time.Duration
+}
+
+type Lockout struct {
+	Kind        LockoutKind
+	Subject     string
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+type LockEvent struct {
+	Kind        LockoutKind
+	Subject     string
+	Failures    int
+	LockedUntil time.Time
+}
+
+// Entries are dropped once they are neither locked nor within ResetAfter of
+// their last failure, on access and in a sweep every lockoutSweepInterval.
+// At most maxLockoutEntries are kept; when the tracker is full, unlocked
+// entries make room first.
+const (
+	lockoutSweepInterval = time.Minute
+	maxLockoutEntries    = 100000
+)
+
+type lockoutKey struct {
+	kind    LockoutKind
+	subject string
+}
+
+// LockoutTracker counts failed authentications per account and per peer
+// address. Once a subject crosses its threshold every further failure
+// locks it for twice as long as the previous one, up to MaxDuration.
+type LockoutTracker struct {
+	m sync.Mutex
+
+	config    LockoutConfig
+	entries   map[lockoutKey]*Lockout
+	onLock    func(LockEvent)
+	lastSweep time.Time
+}
+
+func NewLockoutTracker(config LockoutConfig, onLock func(LockEvent)) *LockoutTracker {
+	return &LockoutTracker{
+		config:    config,
+		entries:   make(map[lockoutKey]*Lockout),
+		onLock:    onLock,
+		lastSweep: time.Now(),
+	}
+}
+
+func (t *LockoutTracker) expired(entry *Lockout, now time.Time) bool {
+	return now.Sub(entry.LastFailure) > t.config.ResetAfter && now.After(entry.LockedUntil)
+}
+
+// sweep drops expired entries. It must be called with t.m held.
+func (t *LockoutTracker) sweep(now time.Time) {
+	for key, entry := range t.entries {
+		if t.expired(entry, now) {
+			delete(t.entries, key)
+		}
+	}
+	t.lastSweep = now
+}
+
+// makeRoom evicts entries until there's room for a new one, unlocked ones
+// first. It must be called with t.m held.
+func (t *LockoutTracker) makeRoom(now time.Time) {
+	t.sweep(now)
+
+	for key, entry := range t.entries {
+		if len(t.entries) < maxLockoutEntries {
+			return
+		}
+		if now.After(entry.LockedUntil) {
+			delete(t.entries, key)
+		}
+	}
+
+	for key := range t.entries {
+		if len(t.entries) < maxLockoutEntries {
+			return
+		}
+		delete(t.entries, key)
+	}
+}
+
+func (t *LockoutTracker) threshold(kind LockoutKind) int {
+	if kind == LockoutAccount {
+		return t.config.AccountThreshold
+	}
+	return t.config.PeerThreshold
+}
+
+func (t *LockoutTracker) lockedUntil(key lockoutKey, now time.Time) time.Time {
+	entry, ok := t.entries[key]
+	if !ok {
+		return time.Time{}
+	}
+	if t.expired(entry, now) {
+		delete(t.entries, key)
+		return time.Time{}
+	}
+	if now.After(entry.LockedUntil) {
+		return time.Time{}
+	}
+	return entry.LockedUntil
+}
+
+// Locked reports how long the caller still has to wait before another
+// attempt is allowed for the given account or peer.
+func (t *LockoutTracker) Locked(account, peer string) (time.Duration, bool) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	now := time.Now()
+
+	until := t.lockedUntil(lockoutKey{LockoutPeer, peer}, now)
+	if account != "" {
+		if accountUntil := t.lockedUntil(lockoutKey{LockoutAccount, account}, now); accountUntil.After(until) {
+			until = accountUntil
+		}
+	}
+
+	if until.IsZero() {
+		return 0, false
+	}
+
+	return until.Sub(now), true
+}
+
+func (t *LockoutTracker) Failure(account, peer string) {
+	var events []LockEvent
+
+	t.m.Lock()
+	now := time.Now()
+
+	if now.Sub(t.lastSweep) > lockoutSweepInterval {
+		t.sweep(now)
+	}
+
+	if account != "" {
+		if event, ok := t.fail(lockoutKey{LockoutAccount, account}, now); ok {
+			events = append(events, event)
+		}
+	}
+	if event, ok := t.fail(lockoutKey{LockoutPeer, peer}, now); ok {
+		events = append(events, event)
+	}
+	t.m.Unlock()
+
+	if t.onLock != nil {
+		for _, event := range events {
+			t.onLock(event)
+		}
+	}
+}
+
+func (t *LockoutTracker) fail(key lockoutKey, now time.Time) (LockEvent, bool) {
+	entry, ok := t.entries[key]
+	if !ok || t.expired(entry, now) {
+		if !ok && len(t.entries) >= maxLockoutEntries {
+			t.makeRoom(now)
+		}
+		entry = &Lockout{Kind: key.kind, Subject: key.subject}
+		t.entries[key] = entry
+	}
+
+	entry.Failures++
+	entry.LastFailure = now
+
+	threshold := t.threshold(key.kind)
+	if threshold <= 0 || entry.Failures < threshold {
+		return LockEvent{}, false
+	}
+
+	duration := t.config.BaseDuration
+	for i := threshold; i < entry.Failures && duration < t.config.MaxDuration; i++ {
+		duration *= 2
+	}
+	if duration > t.config.MaxDuration {
+		duration = t.config.MaxDuration
+	}
+
+	entry.LockedUntil = now.Add(duration)
+
+	return LockEvent{
+		Kind:        key.kind,
+		Subject:     key.subject,
+		Failures:    entry.Failures,
+		LockedUntil: entry.LockedUntil,
+	}, true
+}
+
+// Success forgets failures of the account. Peer failures are kept, so one
+// valid account can't be used to keep guessing others from the same peer.
+func (t *LockoutTracker) Success(account string) {
+	t.m.Lock()
+	delete(t.entries, lockoutKey{LockoutAccount, account})
+	t.m.Unlock()
+}
+
+func (t *LockoutTracker) List() []Lockout {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	now := time.Now()
+
+	t.sweep(now)
+
+	result := make([]Lockout, 0, len(t.entries))
+	for _, entry := range t.entries {
+		result = append(result, *entry)
+	}
+
+	slices.SortFunc(result, func(a, b Lockout) int {
+		if c := strings.Compare(string(a.Kind), string(b.Kind)); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Subject, b.Subject)
+	})
+
+	return result
+}
+
+func (t *LockoutTracker) Clear(kind LockoutKind, subject string) bool {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	key := lockoutKey{kind, subject}
+
+	_, ok := t.entries[key]
+	delete(t.entries, key)
+
+	return ok
+}
+
+// authAttempt is shared by the auth middleware, the interceptors after it
+// and the handler, which verifies the credentials.
+type authAttempt struct {
+	m sync.Mutex
+
+	reported  bool
+	succeeded bool
+
+	userId string
+	// onAuthenticated is run once the handler has verified who the caller
+	// is, and may still refuse the call.
+	onAuthenticated func(ctx context.Context, userId string) error
+}
+
+type authAttemptKey struct{}
+
+// AuthFailed and AuthSucceeded let the handler tell the auth middleware how
+// credential verification went, since the middleware itself only extracts
+// credentials and can't verify them.
+func AuthFailed(ctx context.Context) {
+	reportAuth(ctx, false)
+}
+
+func AuthSucceeded(ctx context.Context) {
+	reportAuth(ctx, true)
+}
+
+func reportAuth(ctx context.Context, succeeded bool) {
+	attempt, ok := ctx.Value(authAttemptKey{}).(*authAttempt)
+	if !ok {
+		return
+	}
+
+	attempt.m.Lock()
+	attempt.reported = true
+	attempt.succeeded = succeeded
+	attempt.m.Unlock()
+}
+
+// Authenticated records the user the handler verified the call's
+// credentials as, and charges the user's rate limit bucket. It fails with
+// ResourceExhausted when the bucket is empty.
+func Authenticated(ctx context.Context, userId string) error {
+	attempt, ok := ctx.Value(authAttemptKey{}).(*authAttempt)
+	if !ok {
+		return nil
+	}
+
+	attempt.m.Lock()
+	attempt.userId = userId
+	onAuthenticated := attempt.onAuthenticated
+	attempt.m.Unlock()
+
+	if onAuthenticated == nil {
+		return nil
+	}
+	return onAuthenticated(ctx, userId)
+}
+
+// AuthenticatedUser returns the id of the user the call's credentials were
+// verified as, once the handler has done so.
+func AuthenticatedUser(ctx context.Context) (string, bool) {
+	attempt, ok := ctx.Value(authAttemptKey{}).(*authAttempt)
+	if !ok {
+		return "", false
+	}
+
+	attempt.m.Lock()
+	defer attempt.m.Unlock()
+
+	return attempt.userId, attempt.userId != ""
+}
@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func testLockouts() *LockoutTracker {
+	return NewLockoutTracker(LockoutConfig{
+		AccountThreshold: 3,
+		PeerThreshold:    5,
+		BaseDuration:     time.Minute,
+		MaxDuration:      10 * time.Minute,
+		ResetAfter:       15 * time.Minute,
+	}, nil)
+}
+
+func TestLockoutBackoff(t *testing.T) {
+	tracker := testLockouts()
+	key := lockoutKey{LockoutAccount, "alice"}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Failures come a second apart, each extending the lock.
+	tests := []struct {
+		failures int
+		lockFor  time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 8 * time.Minute},
+		{7, 10 * time.Minute},
+		{8, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		now := start.Add(time.Duration(tt.failures) * time.Second)
+
+		event, locked := tracker.fail(key, now)
+		if locked != (tt.lockFor > 0) {
+			t.Fatalf("Failure %d locked: %t, want %t", tt.failures, locked, tt.lockFor > 0)
+		}
+		if !locked {
+			continue
+		}
+
+		if event.Failures != tt.failures || event.Kind != LockoutAccount || event.Subject != "alice" {
+			t.Errorf("Failure %d: got event %+v", tt.failures, event)
+		}
+		if got := event.LockedUntil.Sub(now); got != tt.lockFor {
+			t.Errorf("Failure %d locks for %v, want %v", tt.failures, got, tt.lockFor)
+		}
+	}
+
+	// Once the lock is over and ResetAfter has passed, counting starts over.
+	later := start.Add(time.Hour)
+	if _, locked := tracker.fail(key, later); locked {
+		t.Error("First failure after the reset locked")
+	}
+	if failures := tracker.entries[key].Failures; failures != 1 {
+		t.Errorf("Got %d failures after the reset, want 1", failures)
+	}
+}
+
+func TestLockoutThresholds(t *testing.T) {
+	tracker := testLockouts()
+
+	for i := 0; i < 3; i++ {
+		tracker.Failure(fmt.Sprintf("user%d", i), "192.0.2.1")
+	}
+	if _, locked := tracker.Locked("user0", "192.0.2.1"); locked {
+		t.Fatal("Locked before either threshold")
+	}
+
+	tracker.Failure("user3", "192.0.2.1")
+	tracker.Failure("user4", "192.0.2.1")
+	if _, locked := tracker.Locked("", "192.0.2.1"); !locked {
+		t.Error("Peer isn't locked after 5 failures across accounts")
+	}
+	if _, locked := tracker.Locked("user0", "192.0.2.2"); locked {
+		t.Error("Account with a single failure is locked from another peer")
+	}
+
+	for i := 0; i < 3; i++ {
+		tracker.Failure("alice", "192.0.2.3")
+	}
+	if retryAfter, locked := tracker.Locked("alice", "192.0.2.4"); !locked || retryAfter > time.Minute {
+		t.Errorf("Account locked: %t for %v, want locked for up to a minute", locked, retryAfter)
+	}
+
+	// Success forgets account failures but not those of the peer.
+	tracker.Success("alice")
+	if _, locked := tracker.Locked("alice", "192.0.2.4"); locked {
+		t.Error("Account is still locked after a success")
+	}
+	if _, locked := tracker.Locked("", "192.0.2.1"); !locked {
+		t.Error("Success of another account unlocked the peer")
+	}
+}
+
+func TestLockoutSweep(t *testing.T) {
+	tracker := testLockouts()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		entry Lockout
+		kept  bool
+	}{
+		{"recent failure", Lockout{LastFailure: now.Add(-time.Minute)}, true},
+		{"old failure", Lockout{LastFailure: now.Add(-time.Hour)}, false},
+		{"old failure still locked", Lockout{LastFailure: now.Add(-time.Hour), LockedUntil: now.Add(time.Minute)}, true},
+		{"old failure lock over", Lockout{LastFailure: now.Add(-time.Hour), LockedUntil: now.Add(-time.Minute)}, false},
+	}
+
+	for _, tt := range tests {
+		entry := tt.entry
+		tracker.entries[lockoutKey{LockoutAccount, tt.name}] = &entry
+	}
+
+	tracker.sweep(now)
+
+	for _, tt := range tests {
+		if _, ok := tracker.entries[lockoutKey{LockoutAccount, tt.name}]; ok != tt.kept {
+			t.Errorf("%s: kept %t, want %t", tt.name, ok, tt.kept)
+		}
+	}
+	if !tracker.lastSweep.Equal(now) {
+		t.Errorf("Last sweep at %v, want %v", tracker.lastSweep, now)
+	}
+}
+
+// TestLockoutMakeRoom checks that a full tracker evicts unlocked entries
+// before locked ones.
+func TestLockoutMakeRoom(t *testing.T) {
+	tracker := testLockouts()
+	now := time.Now()
+
+	locked := lockoutKey{LockoutAccount, "locked"}
+	tracker.entries[locked] = &Lockout{LastFailure: now, LockedUntil: now.Add(time.Hour)}
+	for i := 1; i < maxLockoutEntries; i++ {
+		tracker.entries[lockoutKey{LockoutPeer, fmt.Sprint(i)}] = &Lockout{LastFailure: now}
+	}
+
+	tracker.fail(lockoutKey{LockoutAccount, "new"}, now)
+
+	if len(tracker.entries) > maxLockoutEntries {
+		t.Errorf("Got %d entries, want at most %d", len(tracker.entries), maxLockoutEntries)
+	}
+	if _, ok := tracker.entries[locked]; !ok {
+		t.Error("Locked entry was evicted")
+	}
+	if _, ok := tracker.entries[lockoutKey{LockoutAccount, "new"}]; !ok {
+		t.Error("New entry wasn't added")
+	}
+}
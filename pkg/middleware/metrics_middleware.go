@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gorobot-nz/test-task/pkg/metrics"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+func splitMethod(fullMethod string) (string, string) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !ok {
+		return "unknown", "unknown"
+	}
+	return service, method
+}
+
+func streamType(info *grpc.StreamServerInfo) string {
+	switch {
+	case info.IsClientStream && info.IsServerStream:
+		return "bidi_stream"
+	case info.IsClientStream:
+		return "client_stream"
+	default:
+		return "server_stream"
+	}
+}
+
+func observeRPC(rpcType, fullMethod string, start time.Time, err error) {
+	service, method := splitMethod(fullMethod)
+
+	metrics.RPCDuration.WithLabelValues(rpcType, service, method).Observe(time.Since(start).Seconds())
+	metrics.RPCHandled.WithLabelValues(rpcType, service, method, status.Code(err).String()).Inc()
+}
+
+func MetricsMiddleware() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		observeRPC("unary", info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+func StreamMetricsMiddleware() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		observeRPC(streamType(info), info.FullMethod, start, err)
+		return err
+	}
+}
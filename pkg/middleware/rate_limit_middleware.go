@@ -0,0 +1,238 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RateLimitKey string
+
+const (
+	RateLimitByPeer      RateLimitKey = "peer"
+	RateLimitByPrincipal RateLimitKey = "principal"
+)
+
+type RateLimit struct {
+	Rate  rate.Limit
+	Burst int
+}
+
+type RateLimitConfig struct {
+	KeyBy   RateLimitKey
+	Default RateLimit
+	Methods map[string]RateLimit
+}
+
+// The limiter sweeps its buckets every rateLimiterSweepInterval and keeps at
+// most maxRateLimiters of them. Full buckets go first, since a new bucket
+// behaves the same; past that arbitrary ones do, which at worst hands their
+// callers a fresh burst.
+const (
+	rateLimiterSweepInterval = time.Minute
+	maxRateLimiters          = 100000
+)
+
+type RateLimiter struct {
+	m sync.Mutex
+
+	config    RateLimitConfig
+	limiters  map[string]*rate.Limiter
+	lastSweep time.Time
+}
+
+func NewRateLimiter(config RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		config:    config,
+		limiters:  make(map[string]*rate.Limiter),
+		lastSweep: time.Now(),
+	}
+}
+
+// ParseRateLimits reads per-method limits written as
+// "/pkg.Service/Method=rate:burst" pairs separated by commas.
+func ParseRateLimits(s string) (map[string]RateLimit, error) {
+	result := make(map[string]RateLimit)
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		method, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed rate limit %q", item)
+		}
+
+		limit, err := ParseRateLimit(value)
+		if err != nil {
+			return nil, err
+		}
+
+		result[method] = limit
+	}
+
+	return result, nil
+}
+
+func ParseRateLimit(s string) (RateLimit, error) {
+	r, b, ok := strings.Cut(s, ":")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("malformed rate limit %q", s)
+	}
+
+	perSecond, err := strconv.ParseFloat(r, 64)
+	if err != nil {
+		return RateLimit{}, err
+	}
+
+	burst, err := strconv.Atoi(b)
+	if err != nil {
+		return RateLimit{}, err
+	}
+
+	return RateLimit{Rate: rate.Limit(perSecond), Burst: burst}, nil
+}
+
+func (r *RateLimiter) limitFor(method string) RateLimit {
+	if limit, ok := r.config.Methods[method]; ok {
+		return limit
+	}
+	return r.config.Default
+}
+
+func (r *RateLimiter) reserve(method, caller string) (time.Duration, bool) {
+	limit := r.limitFor(method)
+	if limit.Rate == rate.Inf || limit.Burst <= 0 {
+		return 0, true
+	}
+
+	key := method + "|" + caller
+	now := time.Now()
+
+	r.m.Lock()
+	if now.Sub(r.lastSweep) > rateLimiterSweepInterval {
+		r.sweep(now)
+	}
+
+	limiter, ok := r.limiters[key]
+	if !ok {
+		if len(r.limiters) >= maxRateLimiters {
+			r.sweep(now)
+		}
+		for k := range r.limiters {
+			if len(r.limiters) < maxRateLimiters {
+				break
+			}
+			delete(r.limiters, k)
+		}
+
+		limiter = rate.NewLimiter(limit.Rate, limit.Burst)
+		r.limiters[key] = limiter
+	}
+	r.m.Unlock()
+
+	reservation := limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return time.Second, false
+	}
+
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		reservation.CancelAt(now)
+		return delay, false
+	}
+
+	return 0, true
+}
+
+// sweep drops the buckets that have refilled. It must be called with r.m
+// held.
+func (r *RateLimiter) sweep(now time.Time) {
+	for key, limiter := range r.limiters {
+		if limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			delete(r.limiters, key)
+		}
+	}
+	r.lastSweep = now
+}
+
+func rateLimitedError(retryAfter time.Duration) (metadata.MD, error) {
+	seconds := retryAfterSeconds(retryAfter)
+	return metadata.Pairs(retryAfterHeader, strconv.Itoa(seconds)),
+		status.Error(codes.ResourceExhausted, fmt.Sprintf("Rate limit exceeded, retry in %ds", seconds))
+}
+
+// chargeOnAuth defers charging a call that carries credentials until the
+// handler has verified them, when callers are keyed by principal. The call
+// is then charged to the user's bucket, keyed by user id, so neither a
+// claimed username or key nor the certificate used gives a client a fresh
+// bucket. Calls whose credentials fail aren't charged: the lockout tracker
+// throttles those.
+func (r *RateLimiter) chargeOnAuth(ctx context.Context, method string) bool {
+	if r.config.KeyBy != RateLimitByPrincipal {
+		return false
+	}
+
+	attempt, ok := ctx.Value(authAttemptKey{}).(*authAttempt)
+	if !ok {
+		return false
+	}
+
+	attempt.m.Lock()
+	attempt.onAuthenticated = func(ctx context.Context, userId string) error {
+		if retryAfter, ok := r.reserve(method, "user:"+userId); !ok {
+			md, err := rateLimitedError(retryAfter)
+			_ = grpc.SetHeader(ctx, md)
+			return err
+		}
+		return nil
+	}
+	attempt.m.Unlock()
+
+	return true
+}
+
+// UnaryServerInterceptor limits calls by peer, or by the user once the
+// handler has verified their credentials. It must run after AuthMiddleware
+// for the latter.
+func (r *RateLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if r.chargeOnAuth(ctx, info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		if retryAfter, ok := r.reserve(info.FullMethod, "peer:"+peerAddress(ctx)); !ok {
+			md, err := rateLimitedError(retryAfter)
+			_ = grpc.SetHeader(ctx, md)
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func (r *RateLimiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if r.chargeOnAuth(ss.Context(), info.FullMethod) {
+			return handler(srv, ss)
+		}
+
+		if retryAfter, ok := r.reserve(info.FullMethod, "peer:"+peerAddress(ss.Context())); !ok {
+			md, err := rateLimitedError(retryAfter)
+			_ = ss.SetHeader(md)
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
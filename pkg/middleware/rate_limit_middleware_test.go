@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"testing"
+	"time"
+
+	userv1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// basicCall returns the context of a call from a single peer with Basic
+// credentials for username.
+func basicCall(username string) context.Context {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 4242},
+	})
+	credentials := base64.StdEncoding.EncodeToString([]byte(username + ":password"))
+	return metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "basic "+credentials))
+}
+
+func TestRateLimitByPrincipal(t *testing.T) {
+	limiter := NewRateLimiter(RateLimitConfig{
+		KeyBy:   RateLimitByPrincipal,
+		Default: RateLimit{Rate: rate.Every(1 << 40), Burst: 1},
+	})
+	auth := AuthMiddleware(CertIdentityNone, nil)
+	limit := limiter.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: userv1.UserService_GetMe_FullMethodName}
+
+	// call stands in for the handler, which verifies the credentials and
+	// then charges the user, here by username.
+	call := func(username string, verified bool) error {
+		_, err := auth(basicCall(username), nil, info, func(ctx context.Context, req any) (any, error) {
+			return limit(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+				if !verified {
+					return nil, status.Error(codes.PermissionDenied, "Permission denied")
+				}
+				if err := Authenticated(ctx, username); err != nil {
+					return nil, err
+				}
+				if id, ok := AuthenticatedUser(ctx); !ok || id != username {
+					t.Errorf("Authenticated user is %q, want %q", id, username)
+				}
+				return nil, nil
+			})
+		})
+		return err
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		verified bool
+		want     codes.Code
+	}{
+		{"failed credentials aren't charged", "alice", false, codes.PermissionDenied},
+		{"first call", "alice", true, codes.OK},
+		{"bucket empty", "alice", true, codes.ResourceExhausted},
+		{"other user on the same peer", "bob", true, codes.OK},
+		{"other user's bucket empty", "bob", true, codes.ResourceExhausted},
+	}
+
+	for _, tt := range tests {
+		if got := status.Code(call(tt.username, tt.verified)); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitRefill(t *testing.T) {
+	limiter := NewRateLimiter(RateLimitConfig{
+		KeyBy:   RateLimitByPeer,
+		Default: RateLimit{Rate: 20, Burst: 2},
+	})
+	method := userv1.UserService_GetUsers_FullMethodName
+
+	for i := 0; i < 2; i++ {
+		if _, ok := limiter.reserve(method, "peer:a"); !ok {
+			t.Fatalf("Call %d within the burst was refused", i+1)
+		}
+	}
+
+	retryAfter, ok := limiter.reserve(method, "peer:a")
+	if ok {
+		t.Fatal("Call past the burst was allowed")
+	}
+	if retryAfter <= 0 || retryAfter > 50*time.Millisecond {
+		t.Errorf("Retry after %v, want up to one token's 50ms", retryAfter)
+	}
+
+	// A refused call doesn't use up the token it would have waited for.
+	time.Sleep(retryAfter)
+	if _, ok := limiter.reserve(method, "peer:a"); !ok {
+		t.Error("Call after the bucket refilled was refused")
+	}
+
+	if _, ok := limiter.reserve(method, "peer:b"); !ok {
+		t.Error("Another caller's call was refused")
+	}
+}
+
+func TestRateLimitMethods(t *testing.T) {
+	limited := userv1.UserService_GetUsers_FullMethodName
+	unlimited := userv1.UserService_GetMe_FullMethodName
+	config := RateLimitConfig{
+		KeyBy:   RateLimitByPeer,
+		Default: RateLimit{Rate: rate.Inf},
+		Methods: map[string]RateLimit{
+			limited:   {Rate: rate.Every(time.Hour), Burst: 1},
+			unlimited: {Rate: 1, Burst: 0},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		calls  int
+		want   bool
+	}{
+		{"within the method's burst", limited, 1, true},
+		{"past the method's burst", limited, 2, false},
+		{"default", userv1.UserService_GetUserById_FullMethodName, 100, true},
+		{"no burst", unlimited, 100, true},
+	}
+
+	for _, tt := range tests {
+		limiter := NewRateLimiter(config)
+
+		ok := true
+		for i := 0; i < tt.calls; i++ {
+			_, ok = limiter.reserve(tt.method, "peer:a")
+		}
+		if ok != tt.want {
+			t.Errorf("%s: call %d allowed: %t, want %t", tt.name, tt.calls, ok, tt.want)
+		}
+	}
+}
+
+func TestRateLimitSweep(t *testing.T) {
+	limiter := NewRateLimiter(RateLimitConfig{
+		KeyBy:   RateLimitByPeer,
+		Default: RateLimit{Rate: 1, Burst: 2},
+	})
+	method := userv1.UserService_GetUsers_FullMethodName
+
+	limiter.reserve(method, "peer:a")
+	limiter.reserve(method, "peer:b")
+	limiter.reserve(method, "peer:b")
+
+	// One second refills a's bucket but not b's.
+	limiter.m.Lock()
+	limiter.sweep(time.Now().Add(time.Second + 100*time.Millisecond))
+	_, a := limiter.limiters[method+"|peer:a"]
+	_, b := limiter.limiters[method+"|peer:b"]
+	limiter.m.Unlock()
+
+	if a {
+		t.Error("Refilled bucket wasn't swept")
+	}
+	if !b {
+		t.Error("Drained bucket was swept")
+	}
+}
+
+func TestParseRateLimits(t *testing.T) {
+	tests := []struct {
+		value string
+		want  map[string]RateLimit
+		valid bool
+	}{
+		{"", map[string]RateLimit{}, true},
+		{"/a/B=1.5:3", map[string]RateLimit{"/a/B": {Rate: 1.5, Burst: 3}}, true},
+		{" /a/B=1:1 , /a/C=2:4 ,", map[string]RateLimit{"/a/B": {Rate: 1, Burst: 1}, "/a/C": {Rate: 2, Burst: 4}}, true},
+		{"/a/B", nil, false},
+		{"/a/B=1", nil, false},
+		{"/a/B=x:1", nil, false},
+		{"/a/B=1:x", nil, false},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRateLimits(tt.value)
+		if (err == nil) != tt.valid {
+			t.Errorf("ParseRateLimits(%q): %v, want valid %t", tt.value, err, tt.valid)
+			continue
+		}
+		if !tt.valid {
+			continue
+		}
+
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseRateLimits(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+		for method, limit := range tt.want {
+			if got[method] != limit {
+				t.Errorf("ParseRateLimits(%q)[%s] = %v, want %v", tt.value, method, got[method], limit)
+			}
+		}
+	}
+}
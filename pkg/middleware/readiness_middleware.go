@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Readiness rejects calls to the gated services with Unavailable while the
+// server isn't ready, e.g. before its data is loaded or after the final
+// snapshot. Other services, such as health checks, are always served.
+type Readiness struct {
+	ready    atomic.Bool
+	services []string
+}
+
+func NewReadiness(services ...string) *Readiness {
+	return &Readiness{
+		services: services,
+	}
+}
+
+func (r *Readiness) SetReady(ready bool) {
+	r.ready.Store(ready)
+}
+
+func (r *Readiness) check(fullMethod string) error {
+	if r.ready.Load() {
+		return nil
+	}
+
+	service, _ := splitMethod(fullMethod)
+	if !slices.Contains(r.services, service) {
+		return nil
+	}
+
+	return status.Error(codes.Unavailable, "Server is not ready")
+}
+
+func (r *Readiness) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := r.check(info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func (r *Readiness) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := r.check(info.FullMethod); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"context"
+
+	applogger "github.com/gorobot-nz/test-task/pkg/logger"
+
+	grpcrecovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// recoveryOption turns a panic in an interceptor or handler into an
+// Internal error for that call instead of a crash of the whole server.
+func recoveryOption(logger *zap.Logger) grpcrecovery.Option {
+	return grpcrecovery.WithRecoveryHandlerContext(func(ctx context.Context, p any) error {
+		applogger.FromContext(ctx, logger).Error("Recovered from panic", zap.Any("panic", p), zap.Stack("stack"))
+		return status.Error(codes.Internal, "Internal error")
+	})
+}
+
+// RecoveryMiddleware should run after the request id interceptor so the
+// panic is logged with the request fields.
+func RecoveryMiddleware(logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return grpcrecovery.UnaryServerInterceptor(recoveryOption(logger))
+}
+
+func StreamRecoveryMiddleware(logger *zap.Logger) grpc.StreamServerInterceptor {
+	return grpcrecovery.StreamServerInterceptor(recoveryOption(logger))
+}
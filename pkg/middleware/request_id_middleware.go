@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+
+	applogger "github.com/gorobot-nz/test-task/pkg/logger"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const RequestIdHeader = "x-request-id"
+
+const maxRequestIdLength = 128
+
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLength {
+		return false
+	}
+
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// withRequestId keeps the caller's request id when it looks sane and
+// generates one otherwise, then tags the request logger with it.
+func withRequestId(ctx context.Context) string {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIdHeader); len(values) > 0 && validRequestId(values[0]) {
+			id = values[0]
+		}
+	}
+	if id == "" {
+		id = uuid.New().String()
+	}
+
+	applogger.AddFields(ctx,
+		zap.String("request_id", id),
+		zap.String("peer.address", peerAddress(ctx)),
+	)
+
+	return id
+}
+
+// RequestIdMiddleware has to run after the zap logging interceptor, which
+// creates the request logger it adds fields to.
+func RequestIdMiddleware() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		id := withRequestId(ctx)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIdHeader, id))
+
+		return handler(ctx, req)
+	}
+}
+
+func StreamRequestIdMiddleware() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		id := withRequestId(ss.Context())
+		_ = ss.SetHeader(metadata.Pairs(RequestIdHeader, id))
+
+		return handler(srv, ss)
+	}
+}
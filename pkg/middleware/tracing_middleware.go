@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+
+	grpcmiddleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var tracer = otel.Tracer("github.com/gorobot-nz/test-task/pkg/middleware")
+
+// metadataCarrier lets the propagator read trace context from gRPC metadata.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func startRPCSpan(ctx context.Context, fullMethod string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+
+	service, method := splitMethod(fullMethod)
+
+	return tracer.Start(ctx, strings.TrimPrefix(fullMethod, "/"),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.service", service),
+			attribute.String("rpc.method", method),
+			attribute.String("client.address", peerAddress(ctx)),
+		),
+	)
+}
+
+func endRPCSpan(span trace.Span, err error) {
+	st := status.Convert(err)
+
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(st.Code())))
+	if st.Code() != codes.OK {
+		span.SetStatus(otelcodes.Error, st.Message())
+	}
+	span.End()
+}
+
+func TracingMiddleware() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, span := startRPCSpan(ctx, info.FullMethod)
+		resp, err := handler(ctx, req)
+		endRPCSpan(span, err)
+		return resp, err
+	}
+}
+
+func StreamTracingMiddleware() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := startRPCSpan(ss.Context(), info.FullMethod)
+
+		wrapped := grpcmiddleware.WrapServerStream(ss)
+		wrapped.WrappedContext = ctx
+
+		err := handler(srv, wrapped)
+		endRPCSpan(span, err)
+		return err
+	}
+}
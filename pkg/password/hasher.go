@@ -0,0 +1,285 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gorobot-nz/test-task/pkg/metrics"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Algorithm string
+
+const (
+	Bcrypt   Algorithm = "bcrypt"
+	Argon2id Algorithm = "argon2id"
+)
+
+var ErrMismatch = errors.New("password mismatch")
+
+// Limits on hash parameters, both configured and read back from stored
+// hashes, so a corrupt or hostile hash can neither make argon2 panic nor
+// take unbounded time or memory to verify.
+const (
+	maxBcryptCost = 16
+
+	maxArgon2Memory      = 256 * 1024
+	maxArgon2Iterations  = 16
+	maxArgon2Parallelism = 16
+	minArgon2SaltLength  = 8
+	maxArgon2SaltLength  = 64
+	minArgon2KeyLength   = 16
+	maxArgon2KeyLength   = 64
+)
+
+type Argon2Params struct {
+	// In KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+func (p Argon2Params) validate() error {
+	switch {
+	case p.Iterations < 1 || p.Iterations > maxArgon2Iterations:
+		return fmt.Errorf("argon2id iterations %d out of range", p.Iterations)
+	case p.Parallelism < 1 || p.Parallelism > maxArgon2Parallelism:
+		return fmt.Errorf("argon2id parallelism %d out of range", p.Parallelism)
+	case p.Memory < 8*uint32(p.Parallelism) || p.Memory > maxArgon2Memory:
+		return fmt.Errorf("argon2id memory %d out of range", p.Memory)
+	case p.SaltLength < minArgon2SaltLength || p.SaltLength > maxArgon2SaltLength:
+		return fmt.Errorf("argon2id salt length %d out of range", p.SaltLength)
+	case p.KeyLength < minArgon2KeyLength || p.KeyLength > maxArgon2KeyLength:
+		return fmt.Errorf("argon2id key length %d out of range", p.KeyLength)
+	}
+
+	return nil
+}
+
+func validateBcryptCost(cost int) error {
+	if cost < bcrypt.MinCost || cost > maxBcryptCost {
+		return fmt.Errorf("bcrypt cost %d out of range", cost)
+	}
+
+	return nil
+}
+
+type Config struct {
+	Algorithm  Algorithm
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Algorithm:  Argon2id,
+		BcryptCost: 10,
+		Argon2: Argon2Params{
+			Memory:      19 * 1024,
+			Iterations:  2,
+			Parallelism: 1,
+			SaltLength:  16,
+			KeyLength:   32,
+		},
+	}
+}
+
+// Hasher produces hashes with the configured algorithm and verifies hashes
+// made by any supported one. Hashes are kept in PHC string format, which
+// bcrypt's own "$2a$cost$..." encoding already follows.
+type Hasher struct {
+	config Config
+}
+
+func NewHasher(config Config) (*Hasher, error) {
+	switch config.Algorithm {
+	case Bcrypt:
+		if err := validateBcryptCost(config.BcryptCost); err != nil {
+			return nil, err
+		}
+	case Argon2id:
+		if err := config.Argon2.validate(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm %q", config.Algorithm)
+	}
+
+	return &Hasher{
+		config: config,
+	}, nil
+}
+
+func observe(algorithm Algorithm, operation string, start time.Time) {
+	metrics.PasswordHashDuration.WithLabelValues(string(algorithm), operation).Observe(time.Since(start).Seconds())
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	defer observe(h.config.Algorithm, "hash", time.Now())
+
+	if h.config.Algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.config.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	}
+
+	params := h.config.Argon2
+
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	return encodeArgon2id(params, salt, key), nil
+}
+
+func (h *Hasher) Verify(encoded, password string) error {
+	switch {
+	case isBcrypt(encoded):
+		defer observe(Bcrypt, "verify", time.Now())
+
+		if err := validateBcrypt(encoded); err != nil {
+			return err
+		}
+
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrMismatch
+		}
+		return err
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		defer observe(Argon2id, "verify", time.Now())
+
+		params, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return err
+		}
+
+		actual := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(actual, key) != 1 {
+			return ErrMismatch
+		}
+		return nil
+	default:
+		return errors.New("unknown hash format")
+	}
+}
+
+// Validate reports whether encoded is a hash that Verify accepts, for
+// hashes that come from outside, such as imports.
+func (h *Hasher) Validate(encoded string) error {
+	switch {
+	case isBcrypt(encoded):
+		return validateBcrypt(encoded)
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		_, _, _, err := decodeArgon2id(encoded)
+		return err
+	default:
+		return errors.New("unknown hash format")
+	}
+}
+
+// NeedsRehash reports whether the hash was made with another algorithm or
+// with parameters different from the current configuration.
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	switch h.config.Algorithm {
+	case Bcrypt:
+		if !isBcrypt(encoded) {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return err != nil || cost != h.config.BcryptCost
+	case Argon2id:
+		params, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return true
+		}
+		current := h.config.Argon2
+		return params.Memory != current.Memory ||
+			params.Iterations != current.Iterations ||
+			params.Parallelism != current.Parallelism ||
+			uint32(len(salt)) != current.SaltLength ||
+			uint32(len(key)) != current.KeyLength
+	default:
+		return false
+	}
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func validateBcrypt(encoded string) error {
+	// "$2a$" + two digit cost + "$" + 53 characters of salt and hash.
+	if len(encoded) != 60 {
+		return errors.New("malformed bcrypt hash")
+	}
+
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return err
+	}
+
+	return validateBcryptCost(cost)
+}
+
+func encodeArgon2id(params Argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func decodeArgon2id(encoded string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, err
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	if err := params.validate(); err != nil {
+		return params, nil, nil, err
+	}
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,182 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fastArgon2 keeps the tests quick; it's within bounds but far too cheap
+// for real use.
+var fastArgon2 = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func testHasher(t *testing.T, config Config) *Hasher {
+	t.Helper()
+
+	hasher, err := NewHasher(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hasher
+}
+
+func TestNewHasherBounds(t *testing.T) {
+	with := func(change func(p *Argon2Params)) Config {
+		p := fastArgon2
+		change(&p)
+		return Config{Algorithm: Argon2id, Argon2: p}
+	}
+
+	tests := []struct {
+		name   string
+		config Config
+		valid  bool
+	}{
+		{"default", DefaultConfig(), true},
+		{"fast argon2id", Config{Algorithm: Argon2id, Argon2: fastArgon2}, true},
+		{"bcrypt", Config{Algorithm: Bcrypt, BcryptCost: 10}, true},
+		{"bcrypt max cost", Config{Algorithm: Bcrypt, BcryptCost: maxBcryptCost}, true},
+		{"bcrypt cost too low", Config{Algorithm: Bcrypt, BcryptCost: 3}, false},
+		{"bcrypt cost too high", Config{Algorithm: Bcrypt, BcryptCost: maxBcryptCost + 1}, false},
+		{"unknown algorithm", Config{Algorithm: "scrypt"}, false},
+		{"no iterations", with(func(p *Argon2Params) { p.Iterations = 0 }), false},
+		{"too many iterations", with(func(p *Argon2Params) { p.Iterations = maxArgon2Iterations + 1 }), false},
+		{"no parallelism", with(func(p *Argon2Params) { p.Parallelism = 0 }), false},
+		{"too much parallelism", with(func(p *Argon2Params) { p.Parallelism = maxArgon2Parallelism + 1 }), false},
+		{"memory below parallelism", with(func(p *Argon2Params) { p.Parallelism = 16; p.Memory = 127 }), false},
+		{"too much memory", with(func(p *Argon2Params) { p.Memory = maxArgon2Memory + 1 }), false},
+		{"short salt", with(func(p *Argon2Params) { p.SaltLength = minArgon2SaltLength - 1 }), false},
+		{"long salt", with(func(p *Argon2Params) { p.SaltLength = maxArgon2SaltLength + 1 }), false},
+		{"short key", with(func(p *Argon2Params) { p.KeyLength = minArgon2KeyLength - 1 }), false},
+		{"long key", with(func(p *Argon2Params) { p.KeyLength = maxArgon2KeyLength + 1 }), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewHasher(tt.config)
+			if (err == nil) != tt.valid {
+				t.Errorf("NewHasher: %v, want valid %t", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	configs := map[string]Config{
+		"argon2id": {Algorithm: Argon2id, Argon2: fastArgon2},
+		"bcrypt":   {Algorithm: Bcrypt, BcryptCost: 4},
+	}
+
+	for name, config := range configs {
+		t.Run(name, func(t *testing.T) {
+			hasher := testHasher(t, config)
+
+			hash, err := hasher.Hash("Password1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := hasher.Validate(hash); err != nil {
+				t.Errorf("Validate: %v", err)
+			}
+			if err := hasher.Verify(hash, "Password1"); err != nil {
+				t.Errorf("Verify with the password: %v", err)
+			}
+			if err := hasher.Verify(hash, "Password2"); !errors.Is(err, ErrMismatch) {
+				t.Errorf("Verify with another password: %v, want ErrMismatch", err)
+			}
+		})
+	}
+}
+
+// TestVerifyRejectsHostileHashes checks that hashes with parameters out of
+// bounds fail before any work is done for them, rather than as a mismatch.
+func TestVerifyRejectsHostileHashes(t *testing.T) {
+	salt := make([]byte, 16)
+	key := make([]byte, 32)
+	argon2id := func(change func(p *Argon2Params)) string {
+		p := fastArgon2
+		change(&p)
+		return encodeArgon2id(p, salt, key)
+	}
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"empty", ""},
+		{"unknown format", "$scrypt$ln=16,r=8,p=1$c2FsdA$a2V5"},
+		{"bcrypt cost too high", "$2a$31$" + strings.Repeat("a", 53)},
+		{"bcrypt cost too low", "$2a$02$" + strings.Repeat("a", 53)},
+		{"truncated bcrypt", "$2a$10$" + strings.Repeat("a", 20)},
+		{"argon2id huge memory", argon2id(func(p *Argon2Params) { p.Memory = 1 << 30 })},
+		{"argon2id many iterations", argon2id(func(p *Argon2Params) { p.Iterations = 1 << 20 })},
+		{"argon2id no parallelism", argon2id(func(p *Argon2Params) { p.Parallelism = 0 })},
+		{"argon2id short salt", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$" + strings.Repeat("A", 43)},
+		{"argon2id short key", "$argon2id$v=19$m=64,t=1,p=1$" + strings.Repeat("A", 22) + "$a2V5"},
+		{"argon2id other version", "$argon2id$v=16$m=64,t=1,p=1$" + strings.Repeat("A", 22) + "$" + strings.Repeat("A", 43)},
+		{"argon2id missing part", "$argon2id$v=19$m=64,t=1,p=1$" + strings.Repeat("A", 22)},
+		{"argon2id bad base64", "$argon2id$v=19$m=64,t=1,p=1$!!!$" + strings.Repeat("A", 43)},
+	}
+
+	hasher := testHasher(t, Config{Algorithm: Argon2id, Argon2: fastArgon2})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := hasher.Validate(tt.hash); err == nil {
+				t.Error("Validate accepted the hash")
+			}
+			if err := hasher.Verify(tt.hash, "Password1"); err == nil || errors.Is(err, ErrMismatch) {
+				t.Errorf("Verify: %v, want a malformed hash error", err)
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	argon2Hasher := testHasher(t, Config{Algorithm: Argon2id, Argon2: fastArgon2})
+	bcryptHasher := testHasher(t, Config{Algorithm: Bcrypt, BcryptCost: 4})
+
+	argon2Hash, err := argon2Hasher.Hash("Password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptHash, err := bcryptHasher.Hash("Password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed := func(change func(p *Argon2Params)) *Hasher {
+		p := fastArgon2
+		change(&p)
+		return testHasher(t, Config{Algorithm: Argon2id, Argon2: p})
+	}
+
+	tests := []struct {
+		name   string
+		hasher *Hasher
+		hash   string
+		want   bool
+	}{
+		{"argon2id current", argon2Hasher, argon2Hash, false},
+		{"bcrypt current", bcryptHasher, bcryptHash, false},
+		{"bcrypt to argon2id", argon2Hasher, bcryptHash, true},
+		{"argon2id to bcrypt", bcryptHasher, argon2Hash, true},
+		{"bcrypt cost", testHasher(t, Config{Algorithm: Bcrypt, BcryptCost: 5}), bcryptHash, true},
+		{"argon2id memory", changed(func(p *Argon2Params) { p.Memory = 128 }), argon2Hash, true},
+		{"argon2id iterations", changed(func(p *Argon2Params) { p.Iterations = 2 }), argon2Hash, true},
+		{"argon2id parallelism", changed(func(p *Argon2Params) { p.Parallelism = 2 }), argon2Hash, true},
+		{"argon2id salt length", changed(func(p *Argon2Params) { p.SaltLength = 32 }), argon2Hash, true},
+		{"argon2id key length", changed(func(p *Argon2Params) { p.KeyLength = 64 }), argon2Hash, true},
+		{"malformed", argon2Hasher, "$argon2id$", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.NeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("NeedsRehash = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
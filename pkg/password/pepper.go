@@ -0,0 +1,189 @@
+package password
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const pepperPrefix = "$pepper$k="
+
+// Peppers holds the secret keys mixed into passwords before hashing. The
+// key file has one "id:base64-secret" pair per line; the last one is the
+// current key, so rotating means appending a new line and keeping the old
+// ones until no hash uses them.
+type Peppers struct {
+	current string
+	keys    map[string][]byte
+}
+
+func LoadPeppers(path string) (*Peppers, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	peppers := &Peppers{
+		keys: make(map[string][]byte),
+	}
+
+	scanner := bufio.NewScanner(file)
+	number := 0
+
+	for scanner.Scan() {
+		number++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		id, value, ok := strings.Cut(line, ":")
+		if !ok || id == "" || strings.Contains(id, "$") {
+			return nil, fmt.Errorf("malformed pepper on line %d", number)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("pepper %q: %w", id, err)
+		}
+
+		if len(key) < 16 {
+			return nil, fmt.Errorf("pepper %q is shorter than 16 bytes", id)
+		}
+
+		if _, ok := peppers.keys[id]; ok {
+			return nil, fmt.Errorf("duplicate pepper %q", id)
+		}
+
+		peppers.keys[id] = key
+		peppers.current = id
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if peppers.current == "" {
+		return nil, errors.New("no peppers in key file")
+	}
+
+	return peppers, nil
+}
+
+func (p *Peppers) Current() string {
+	return p.current
+}
+
+func (p *Peppers) mix(id, password string) (string, error) {
+	key, ok := p.keys[id]
+	if !ok {
+		return "", fmt.Errorf("unknown pepper %q", id)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(password))
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// KeyID returns the pepper id a hash was made with, or "" for hashes made
+// without a pepper.
+func KeyID(encoded string) string {
+	if !strings.HasPrefix(encoded, pepperPrefix) {
+		return ""
+	}
+
+	id, _, _ := strings.Cut(strings.TrimPrefix(encoded, pepperPrefix), "$")
+
+	return id
+}
+
+// PepperedHasher prefixes every hash with the id of the pepper it used, so
+// older hashes keep verifying after rotation and get rehashed with the
+// current pepper on the next successful login.
+type PepperedHasher struct {
+	hasher  *Hasher
+	peppers *Peppers
+}
+
+func NewPepperedHasher(hasher *Hasher, peppers *Peppers) *PepperedHasher {
+	return &PepperedHasher{
+		hasher:  hasher,
+		peppers: peppers,
+	}
+}
+
+func splitPeppered(encoded string) (string, string, error) {
+	id := KeyID(encoded)
+	if id == "" {
+		return "", "", errors.New("malformed peppered hash")
+	}
+
+	return id, strings.TrimPrefix(encoded, pepperPrefix+id), nil
+}
+
+func (h *PepperedHasher) Hash(password string) (string, error) {
+	id := h.peppers.Current()
+
+	mixed, err := h.peppers.mix(id, password)
+	if err != nil {
+		return "", err
+	}
+
+	inner, err := h.hasher.Hash(mixed)
+	if err != nil {
+		return "", err
+	}
+
+	return pepperPrefix + id + inner, nil
+}
+
+func (h *PepperedHasher) Verify(encoded, password string) error {
+	if !strings.HasPrefix(encoded, pepperPrefix) {
+		return h.hasher.Verify(encoded, password)
+	}
+
+	id, inner, err := splitPeppered(encoded)
+	if err != nil {
+		return err
+	}
+
+	mixed, err := h.peppers.mix(id, password)
+	if err != nil {
+		return err
+	}
+
+	return h.hasher.Verify(inner, mixed)
+}
+
+func (h *PepperedHasher) Validate(encoded string) error {
+	if !strings.HasPrefix(encoded, pepperPrefix) {
+		return h.hasher.Validate(encoded)
+	}
+
+	id, inner, err := splitPeppered(encoded)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := h.peppers.keys[id]; !ok {
+		return fmt.Errorf("unknown pepper %q", id)
+	}
+
+	return h.hasher.Validate(inner)
+}
+
+func (h *PepperedHasher) NeedsRehash(encoded string) bool {
+	id, inner, err := splitPeppered(encoded)
+	if err != nil || id != h.peppers.Current() {
+		return true
+	}
+
+	return h.hasher.NeedsRehash(inner)
+}
@@ -0,0 +1,159 @@
+package password
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pepperFile writes a key file with the given lines and returns its path.
+func pepperFile(t *testing.T, lines ...string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "peppers")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// pepperLine is a key file line for id, with 32 bytes of its first letter.
+func pepperLine(id string) string {
+	return id + ":" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte(id[:1]), 32))
+}
+
+func testPepperedHasher(t *testing.T, ids ...string) *PepperedHasher {
+	t.Helper()
+
+	lines := make([]string, len(ids))
+	for i, id := range ids {
+		lines[i] = pepperLine(id)
+	}
+
+	peppers, err := LoadPeppers(pepperFile(t, lines...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewPepperedHasher(testHasher(t, Config{Algorithm: Argon2id, Argon2: fastArgon2}), peppers)
+}
+
+func TestLoadPeppers(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		current string
+	}{
+		{"single", []string{pepperLine("a")}, "a"},
+		{"last is current", []string{pepperLine("a"), pepperLine("b")}, "b"},
+		{"comments and blank lines", []string{"# old", pepperLine("a"), "", "# new", pepperLine("b"), ""}, "b"},
+		{"empty", []string{"# nothing"}, ""},
+		{"missing id", []string{":" + base64.StdEncoding.EncodeToString(make([]byte, 32))}, ""},
+		{"dollar in id", []string{"a$b:" + base64.StdEncoding.EncodeToString(make([]byte, 32))}, ""},
+		{"bad base64", []string{"a:!!!"}, ""},
+		{"short", []string{"a:" + base64.StdEncoding.EncodeToString(make([]byte, 15))}, ""},
+		{"duplicate", []string{pepperLine("a"), pepperLine("a")}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			peppers, err := LoadPeppers(pepperFile(t, tt.lines...))
+			if tt.current == "" {
+				if err == nil {
+					t.Error("Loaded an invalid key file")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if peppers.Current() != tt.current {
+				t.Errorf("Current pepper is %q, want %q", peppers.Current(), tt.current)
+			}
+		})
+	}
+}
+
+func TestPepperRotation(t *testing.T) {
+	before := testPepperedHasher(t, "old")
+	after := testPepperedHasher(t, "old", "new")
+	dropped := testPepperedHasher(t, "new")
+
+	plain, err := testHasher(t, Config{Algorithm: Argon2id, Argon2: fastArgon2}).Hash("Password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := before.Hash("Password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := after.Hash("Password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if KeyID(plain) != "" || KeyID(old) != "old" || KeyID(current) != "new" {
+		t.Fatalf("Key ids are %q, %q and %q, want none, old and new", KeyID(plain), KeyID(old), KeyID(current))
+	}
+
+	tests := []struct {
+		name     string
+		hasher   *PepperedHasher
+		hash     string
+		verifies bool
+		rehash   bool
+	}{
+		{"unpeppered", after, plain, true, true},
+		{"old pepper", after, old, true, true},
+		{"current pepper", after, current, true, false},
+		{"old pepper dropped", dropped, old, false, true},
+		{"before rotation", before, current, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.hasher.Verify(tt.hash, "Password1")
+			if (err == nil) != tt.verifies {
+				t.Errorf("Verify: %v, want verified %t", err, tt.verifies)
+			}
+			if err := tt.hasher.Validate(tt.hash); (err == nil) != tt.verifies {
+				t.Errorf("Validate: %v, want valid %t", err, tt.verifies)
+			}
+			if got := tt.hasher.NeedsRehash(tt.hash); got != tt.rehash {
+				t.Errorf("NeedsRehash = %t, want %t", got, tt.rehash)
+			}
+
+			if tt.verifies {
+				if err := tt.hasher.Verify(tt.hash, "Password2"); !errors.Is(err, ErrMismatch) {
+					t.Errorf("Verify with another password: %v, want ErrMismatch", err)
+				}
+			}
+		})
+	}
+}
+
+// TestPepperIsSecret checks that a hash made with a pepper doesn't verify
+// under the same id with another secret, so guesses can't be checked
+// against a leaked store without the key file.
+func TestPepperIsSecret(t *testing.T) {
+	hash, err := testPepperedHasher(t, "a").Hash("Password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := LoadPeppers(pepperFile(t, "a:"+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("z"), 32))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasher := NewPepperedHasher(testHasher(t, Config{Algorithm: Argon2id, Argon2: fastArgon2}), other)
+
+	if err := hasher.Verify(hash, "Password1"); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Verify with another secret: %v, want ErrMismatch", err)
+	}
+}
@@ -0,0 +1,358 @@
+package query
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Filter is a parsed AIP-160 filter. The supported subset covers
+// comparisons of top-level scalar and timestamp fields (=, !=, <, <=, >, >=
+// and : for case-insensitive substring matches), AND, OR, NOT and
+// parentheses. A trailing * in an = string value matches a prefix.
+type Filter struct {
+	root node
+}
+
+type node interface {
+	match(m protoreflect.Message) (bool, error)
+}
+
+type andNode []node
+
+func (n andNode) match(m protoreflect.Message) (bool, error) {
+	for _, child := range n {
+		ok, err := child.match(m)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+type orNode []node
+
+func (n orNode) match(m protoreflect.Message) (bool, error) {
+	for _, child := range n {
+		ok, err := child.match(m)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+type notNode struct {
+	child node
+}
+
+func (n notNode) match(m protoreflect.Message) (bool, error) {
+	ok, err := n.child.match(m)
+	return !ok, err
+}
+
+// MaxDepth is how deeply parentheses may be nested in a filter. Each level
+// is a recursive call, so the limit keeps untrusted filters from exhausting
+// the stack.
+const MaxDepth = 32
+
+type restriction struct {
+	field      string
+	comparator string
+	value      string
+}
+
+// ParseFilter parses expr and checks that it only refers to the given
+// fields. An empty expression matches everything.
+func ParseFilter(expr string, fields ...string) (*Filter, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, fields: fields}
+
+	if p.peek().kind == tokenEOF {
+		return &Filter{}, nil
+	}
+
+	root, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", t.value, t.pos)
+	}
+
+	return &Filter{root: root}, nil
+}
+
+func (f *Filter) Match(msg proto.Message) (bool, error) {
+	if f == nil || f.root == nil {
+		return true, nil
+	}
+	return f.root.match(msg.ProtoReflect())
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	fields []string
+	depth  int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) keyword(word string) bool {
+	t := p.peek()
+	if t.kind == tokenText && t.value == word {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expression = sequence {"AND" sequence}
+func (p *parser) expression() (node, error) {
+	nodes := andNode{}
+
+	for {
+		n, err := p.sequence()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+
+		if !p.keyword("AND") {
+			break
+		}
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+// sequence = factor {factor}, adjacent factors are implicitly ANDed.
+func (p *parser) sequence() (node, error) {
+	nodes := andNode{}
+
+	for {
+		n, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+
+		t := p.peek()
+		if t.kind == tokenEOF || t.kind == tokenRParen || (t.kind == tokenText && t.value == "AND") {
+			break
+		}
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+// factor = term {"OR" term}, OR binds tighter than AND as in AIP-160.
+func (p *parser) factor() (node, error) {
+	nodes := orNode{}
+
+	for {
+		n, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+
+		if !p.keyword("OR") {
+			break
+		}
+	}
+
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *parser) term() (node, error) {
+	if p.keyword("NOT") {
+		n, err := p.simple()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{child: n}, nil
+	}
+
+	if t := p.peek(); t.kind == tokenText && strings.HasPrefix(t.value, "-") {
+		if t.value == "-" {
+			p.next()
+		} else {
+			p.tokens[p.pos].value = t.value[1:]
+		}
+		n, err := p.simple()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{child: n}, nil
+	}
+
+	return p.simple()
+}
+
+func (p *parser) simple() (node, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokenLParen:
+		if p.depth == MaxDepth {
+			return nil, fmt.Errorf("parentheses nested deeper than %d at %d", MaxDepth, t.pos)
+		}
+
+		p.depth++
+		n, err := p.expression()
+		p.depth--
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, fmt.Errorf("expected ) at %d", closing.pos)
+		}
+		return n, nil
+	case tokenText:
+		field := t.value
+		if !slices.Contains(p.fields, field) {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+
+		comparator := p.next()
+		if comparator.kind != tokenComparator {
+			return nil, fmt.Errorf("expected comparator after %q at %d", field, comparator.pos)
+		}
+
+		value := p.next()
+		if value.kind != tokenText && value.kind != tokenString {
+			return nil, fmt.Errorf("expected value after %q at %d", comparator.value, value.pos)
+		}
+
+		return &restriction{field: field, comparator: comparator.value, value: value.value}, nil
+	case tokenEOF:
+		return nil, fmt.Errorf("unexpected end of filter")
+	default:
+		return nil, fmt.Errorf("unexpected %q at %d", t.value, t.pos)
+	}
+}
+
+func (r *restriction) match(m protoreflect.Message) (bool, error) {
+	fd := m.Descriptor().Fields().ByName(protoreflect.Name(r.field))
+	if fd == nil || fd.IsList() || fd.IsMap() {
+		return false, fmt.Errorf("field %q can't be filtered", r.field)
+	}
+
+	value := m.Get(fd)
+
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return r.matchString(value.String())
+	case protoreflect.BoolKind:
+		want, err := strconv.ParseBool(r.value)
+		if err != nil {
+			return false, fmt.Errorf("field %q: %w", r.field, err)
+		}
+		switch r.comparator {
+		case "=", ":":
+			return value.Bool() == want, nil
+		case "!=":
+			return value.Bool() != want, nil
+		}
+	case protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.Sint32Kind, protoreflect.Sint64Kind,
+		protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind:
+		want, err := strconv.ParseInt(r.value, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("field %q: %w", r.field, err)
+		}
+		return r.compare(compareOrdered(value.Int(), want))
+	case protoreflect.Uint32Kind, protoreflect.Uint64Kind, protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+		want, err := strconv.ParseUint(r.value, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("field %q: %w", r.field, err)
+		}
+		return r.compare(compareOrdered(value.Uint(), want))
+	case protoreflect.MessageKind:
+		if fd.Message().FullName() != "google.protobuf.Timestamp" {
+			break
+		}
+		want, err := time.Parse(time.RFC3339, r.value)
+		if err != nil {
+			return false, fmt.Errorf("field %q: %w", r.field, err)
+		}
+		var got time.Time
+		if m.Has(fd) {
+			got = value.Message().Interface().(*timestamppb.Timestamp).AsTime()
+		}
+		return r.compare(got.Compare(want))
+	}
+
+	return false, fmt.Errorf("field %q doesn't support %q", r.field, r.comparator)
+}
+
+func (r *restriction) matchString(got string) (bool, error) {
+	if r.comparator == ":" {
+		return strings.Contains(strings.ToLower(got), strings.ToLower(r.value)), nil
+	}
+
+	if prefix, ok := strings.CutSuffix(r.value, "*"); ok && (r.comparator == "=" || r.comparator == "!=") {
+		return strings.HasPrefix(got, prefix) == (r.comparator == "="), nil
+	}
+
+	return r.compare(strings.Compare(got, r.value))
+}
+
+func (r *restriction) compare(result int) (bool, error) {
+	switch r.comparator {
+	case "=":
+		return result == 0, nil
+	case "!=":
+		return result != 0, nil
+	case "<":
+		return result < 0, nil
+	case "<=":
+		return result <= 0, nil
+	case ">":
+		return result > 0, nil
+	case ">=":
+		return result >= 0, nil
+	}
+	return false, fmt.Errorf("field %q doesn't support %q", r.field, r.comparator)
+}
+
+func compareOrdered[T int64 | uint64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
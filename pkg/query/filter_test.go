@@ -0,0 +1,129 @@
+package query
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	userv1 "github.com/gorobot-nz/test-task/gen/proto/user/v1"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var filterFields = []string{"id", "email", "username", "admin", "email_verified", "create_time"}
+
+func nested(depth int, expr string) string {
+	return strings.Repeat("(", depth) + expr + strings.Repeat(")", depth)
+}
+
+func TestFilterMatch(t *testing.T) {
+	alice := &userv1.User{
+		Id:            "1",
+		Email:         "Alice@Example.com",
+		Username:      "alice smith",
+		Admin:         true,
+		EmailVerified: false,
+		CreateTime:    timestamppb.New(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		want bool
+	}{
+		{"empty", "", true},
+		{"equal", "admin = true", true},
+		{"not equal", "admin != true", false},
+		{"or binds tighter than and", "email_verified = true OR admin = true AND id = 2", false},
+		{"parentheses", "email_verified = true OR (admin = true AND id = 2)", false},
+		{"parentheses override", "(email_verified = true OR admin = true) AND id = 1", true},
+		{"implicit and", "admin = true id = 2", false},
+		{"double quoted", `username = "alice smith"`, true},
+		{"single quoted", `username = 'alice smith'`, true},
+		{"escaped quote", `username = "alice \"smith"`, false},
+		{"case sensitive equal", `email = "alice@example.com"`, false},
+		{"substring", `email:"EXAMPLE"`, true},
+		{"substring miss", `email:"corp"`, false},
+		{"prefix", `username = "ali*"`, true},
+		{"not prefix", `username != "ali*"`, false},
+		{"less than", `username < "bob"`, true},
+		{"timestamp", `create_time >= "2024-01-01T00:00:00Z"`, true},
+		{"timestamp before", `create_time < "2024-01-01T00:00:00Z"`, false},
+		{"not", "NOT admin = true", false},
+		{"minus", "-admin = true", false},
+		{"spaced minus", "- email_verified = true", true},
+		{"not group", "NOT (admin = true AND email_verified = true)", true},
+		{"max depth", nested(MaxDepth, "admin = true"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseFilter(tt.expr, filterFields...)
+			if err != nil {
+				t.Fatalf("ParseFilter(%q): %v", tt.expr, err)
+			}
+
+			got, err := f.Match(alice)
+			if err != nil {
+				t.Fatalf("Match: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("%q matched %t, want %t", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{"unknown field", "password = x"},
+		{"missing value", "admin ="},
+		{"missing comparator", "admin true"},
+		{"unclosed parenthesis", "(admin = true"},
+		{"unopened parenthesis", "admin = true)"},
+		{"empty parentheses", "()"},
+		{"dangling and", "admin = true AND"},
+		{"dangling or", "admin = true OR"},
+		{"double not", "NOT NOT admin = true"},
+		{"unterminated string", `username = "alice`},
+		{"bare bang", "admin ! true"},
+		{"unexpected rune", "admin = true;"},
+		{"too deep", nested(MaxDepth+1, "admin = true")},
+		{"far too deep", strings.Repeat("(", 1<<20)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseFilter(tt.expr, filterFields...); err == nil {
+				t.Errorf("ParseFilter(%q) succeeded", tt.expr)
+			}
+		})
+	}
+}
+
+func TestFilterMatchErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{"bool", "admin = maybe"},
+		{"bool comparator", "admin < true"},
+		{"timestamp", `create_time > "yesterday"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseFilter(tt.expr, filterFields...)
+			if err != nil {
+				t.Fatalf("ParseFilter(%q): %v", tt.expr, err)
+			}
+
+			if _, err := f.Match(&userv1.User{}); err == nil {
+				t.Errorf("%q matched without an error", tt.expr)
+			}
+		})
+	}
+}
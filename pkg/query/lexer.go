@@ -0,0 +1,91 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenText
+	tokenString
+	tokenComparator
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+func isTextRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.-@*+", r)
+}
+
+func lex(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, value: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, value: ")", pos: i})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, value: ",", pos: i})
+			i++
+		case r == '=' || r == ':':
+			tokens = append(tokens, token{kind: tokenComparator, value: string(r), pos: i})
+			i++
+		case r == '!' || r == '<' || r == '>':
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				tokens = append(tokens, token{kind: tokenComparator, value: string(runes[i : i+2]), pos: i})
+				i += 2
+				continue
+			}
+			if r == '!' {
+				return nil, fmt.Errorf("unexpected %q at %d", r, i)
+			}
+			tokens = append(tokens, token{kind: tokenComparator, value: string(r), pos: i})
+			i++
+		case r == '"' || r == '\'':
+			var b strings.Builder
+			start := i
+			i++
+			for ; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				b.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenString, value: b.String(), pos: start})
+		case isTextRune(r):
+			start := i
+			for i < len(runes) && isTextRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenText, value: string(runes[start:i]), pos: start})
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", r, i)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(runes)}), nil
+}
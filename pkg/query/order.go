@@ -0,0 +1,118 @@
+package query
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type orderField struct {
+	name string
+	desc bool
+}
+
+// OrderBy is a parsed AIP-132 order_by, e.g. "username desc, create_time".
+type OrderBy struct {
+	fields []orderField
+}
+
+// ParseOrderBy parses expr and checks that it only refers to the given
+// fields.
+func ParseOrderBy(expr string, fields ...string) (*OrderBy, error) {
+	order := &OrderBy{}
+
+	if strings.TrimSpace(expr) == "" {
+		return order, nil
+	}
+
+	for _, part := range strings.Split(expr, ",") {
+		words := strings.Fields(part)
+		if len(words) == 0 || len(words) > 2 {
+			return nil, fmt.Errorf("malformed order %q", strings.TrimSpace(part))
+		}
+
+		if !slices.Contains(fields, words[0]) {
+			return nil, fmt.Errorf("can't order by %q", words[0])
+		}
+
+		field := orderField{name: words[0]}
+		if len(words) == 2 {
+			switch words[1] {
+			case "asc":
+			case "desc":
+				field.desc = true
+			default:
+				return nil, fmt.Errorf("unknown direction %q", words[1])
+			}
+		}
+
+		order.fields = append(order.fields, field)
+	}
+
+	return order, nil
+}
+
+func (o *OrderBy) Empty() bool {
+	return o == nil || len(o.fields) == 0
+}
+
+// Compare orders two messages of the same type by the parsed fields.
+func (o *OrderBy) Compare(a, b proto.Message) int {
+	if o.Empty() {
+		return 0
+	}
+
+	ma, mb := a.ProtoReflect(), b.ProtoReflect()
+
+	for _, field := range o.fields {
+		fd := ma.Descriptor().Fields().ByName(protoreflect.Name(field.name))
+		if fd == nil {
+			continue
+		}
+
+		result := compareValues(fd, ma, mb)
+		if field.desc {
+			result = -result
+		}
+		if result != 0 {
+			return result
+		}
+	}
+
+	return 0
+}
+
+func compareValues(fd protoreflect.FieldDescriptor, a, b protoreflect.Message) int {
+	va, vb := a.Get(fd), b.Get(fd)
+
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return strings.Compare(va.String(), vb.String())
+	case protoreflect.BoolKind:
+		return compareOrdered(boolInt(va.Bool()), boolInt(vb.Bool()))
+	case protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.Sint32Kind, protoreflect.Sint64Kind,
+		protoreflect.Sfixed32Kind, protoreflect.Sfixed64Kind:
+		return compareOrdered(va.Int(), vb.Int())
+	case protoreflect.Uint32Kind, protoreflect.Uint64Kind, protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+		return compareOrdered(va.Uint(), vb.Uint())
+	case protoreflect.MessageKind:
+		if fd.Message().FullName() == "google.protobuf.Timestamp" {
+			ta := va.Message().Interface().(*timestamppb.Timestamp)
+			tb := vb.Message().Interface().(*timestamppb.Timestamp)
+			return ta.AsTime().Compare(tb.AsTime())
+		}
+	}
+
+	return 0
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -1,43 +1,114 @@
 package storage
 
 import (
+	"context"
 	"slices"
 	"sync"
+	"time"
+
+	"github.com/gorobot-nz/test-task/pkg/metrics"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/gorobot-nz/test-task/pkg/storage")
+
 type Storage[V any] struct {
 	m sync.Mutex
 
+	name       string
 	storageMap map[string]V
 	keysSlice  []string
 }
 
-func NewStorage[V any]() *Storage[V] {
+// NewStorage creates an empty storage. The name labels its metrics.
+func NewStorage[V any](name string) *Storage[V] {
+	metrics.StorageItems.WithLabelValues(name).Set(0)
+
 	return &Storage[V]{
 		m:          sync.Mutex{},
+		name:       name,
 		storageMap: make(map[string]V),
 		keysSlice:  make([]string, 0, 1024),
 	}
 }
 
-func (s *Storage[V]) Set(key string, value V) {
+func (s *Storage[V]) startSpan(ctx context.Context, operation string) trace.Span {
+	_, span := tracer.Start(ctx, "Storage."+operation, trace.WithAttributes(
+		attribute.String("storage.name", s.name),
+	))
+	return span
+}
+
+func (s *Storage[V]) observe(operation string, start time.Time) {
+	metrics.StorageOperationDuration.WithLabelValues(s.name, operation).Observe(time.Since(start).Seconds())
+}
+
+// updateSize must be called with the lock held.
+func (s *Storage[V]) updateSize() {
+	metrics.StorageItems.WithLabelValues(s.name).Set(float64(len(s.storageMap)))
+}
+
+func (s *Storage[V]) Set(ctx context.Context, key string, value V) {
+	span := s.startSpan(ctx, "Set")
+	defer span.End()
+	defer s.observe("set", time.Now())
+
 	s.m.Lock()
 	s.storageMap[key] = value
 
 	if !slices.Contains(s.keysSlice, key) {
 		s.keysSlice = append(s.keysSlice, key)
 	}
+	s.updateSize()
 	s.m.Unlock()
 }
 
-func (s *Storage[V]) Get(key string) (V, bool) {
+func (s *Storage[V]) Get(ctx context.Context, key string) (V, bool) {
+	span := s.startSpan(ctx, "Get")
+	defer span.End()
+	defer s.observe("get", time.Now())
+
 	s.m.Lock()
 	val, ok := s.storageMap[key]
 	s.m.Unlock()
 	return val, ok
 }
 
-func (s *Storage[V]) List() []V {
+// Update replaces the value under key with the one fn returns, holding the
+// lock throughout so no other change can come in between. Nothing is
+// stored when the key is missing or fn fails.
+func (s *Storage[V]) Update(ctx context.Context, key string, fn func(value V) (V, error)) (V, bool, error) {
+	span := s.startSpan(ctx, "Update")
+	defer span.End()
+	defer s.observe("update", time.Now())
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	val, ok := s.storageMap[key]
+	if !ok {
+		return val, false, nil
+	}
+
+	updated, err := fn(val)
+	if err != nil {
+		var zero V
+		return zero, true, err
+	}
+
+	s.storageMap[key] = updated
+
+	return updated, true, nil
+}
+
+func (s *Storage[V]) List(ctx context.Context) []V {
+	span := s.startSpan(ctx, "List")
+	defer span.End()
+	defer s.observe("list", time.Now())
+
 	s.m.Lock()
 	var result = make([]V, len(s.keysSlice))
 
@@ -49,16 +120,38 @@ func (s *Storage[V]) List() []V {
 	return result
 }
 
-func (s *Storage[V]) Delete(key string) {
+func (s *Storage[V]) Delete(ctx context.Context, key string) {
+	span := s.startSpan(ctx, "Delete")
+	defer span.End()
+	defer s.observe("delete", time.Now())
+
 	s.m.Lock()
 	index := slices.Index(s.keysSlice, key)
 	if index != -1 {
 		s.keysSlice = slices.Delete(s.keysSlice, index, index+1)
 		delete(s.storageMap, key)
 	}
+	s.updateSize()
 	s.m.Unlock()
 }
 
+func (s *Storage[V]) Pop(ctx context.Context, key string) (V, bool) {
+	span := s.startSpan(ctx, "Pop")
+	defer span.End()
+	defer s.observe("pop", time.Now())
+
+	s.m.Lock()
+	val, ok := s.storageMap[key]
+	if ok {
+		index := slices.Index(s.keysSlice, key)
+		s.keysSlice = slices.Delete(s.keysSlice, index, index+1)
+		delete(s.storageMap, key)
+	}
+	s.updateSize()
+	s.m.Unlock()
+	return val, ok
+}
+
 func (s *Storage[V]) Size() uint64 {
 	s.m.Lock()
 	var size = uint64(len(s.storageMap))
@@ -0,0 +1,96 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const (
+	Digits = 6
+	Period = 30 * time.Second
+	Skew   = 1
+
+	secretSize = 20
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+func EncodeSecret(secret []byte) string {
+	return encoding.EncodeToString(secret)
+}
+
+func URI(issuer, account string, secret []byte) string {
+	values := url.Values{}
+	values.Set("secret", EncodeSecret(secret))
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(Digits))
+	values.Set("period", fmt.Sprint(int(Period.Seconds())))
+
+	label := url.PathEscape(issuer + ":" + account)
+
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, values.Encode())
+}
+
+func Code(secret []byte, t time.Time) string {
+	return code(secret, uint64(t.Unix())/uint64(Period.Seconds()))
+}
+
+func Validate(secret []byte, passcode string, t time.Time) bool {
+	_, ok := ValidateStep(secret, passcode, t)
+	return ok
+}
+
+// ValidateStep is Validate that also returns the time step the passcode
+// belongs to, so a caller can refuse codes at or before the last step it
+// accepted and a code can't be replayed within its window.
+func ValidateStep(secret []byte, passcode string, t time.Time) (int64, bool) {
+	if len(passcode) != Digits {
+		return 0, false
+	}
+
+	counter := int64(t.Unix()) / int64(Period.Seconds())
+
+	for i := int64(-Skew); i <= Skew; i++ {
+		expected := code(secret, uint64(counter+i))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(passcode)) == 1 {
+			return counter + i, true
+		}
+	}
+
+	return 0, false
+}
+
+func code(secret []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < Digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", Digits, value%mod)
+}
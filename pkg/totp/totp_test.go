@@ -0,0 +1,87 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 secret of the RFC 6238 test vectors.
+var rfcSecret = []byte("12345678901234567890")
+
+// TestCode checks the RFC 6238 appendix B SHA-1 vectors, which are given
+// with 8 digits; a 6 digit code is their last 6.
+func TestCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		if got := Code(rfcSecret, time.Unix(tt.unix, 0)); got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateStep(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / int64(Period.Seconds())
+
+	tests := []struct {
+		name     string
+		passcode string
+		step     int64
+		ok       bool
+	}{
+		{"current", Code(rfcSecret, now), step, true},
+		{"previous step", Code(rfcSecret, now.Add(-Period)), step - 1, true},
+		{"next step", Code(rfcSecret, now.Add(Period)), step + 1, true},
+		{"outside skew before", Code(rfcSecret, now.Add(-2*Period)), 0, false},
+		{"outside skew after", Code(rfcSecret, now.Add(2*Period)), 0, false},
+		{"other secret", Code([]byte("09876543210987654321"), now), 0, false},
+		{"too short", Code(rfcSecret, now)[1:], 0, false},
+		{"too long", Code(rfcSecret, now) + "0", 0, false},
+		{"empty", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ValidateStep(rfcSecret, tt.passcode, now)
+			if ok != tt.ok || got != tt.step {
+				t.Errorf("ValidateStep = %d, %t, want %d, %t", got, ok, tt.step, tt.ok)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(URI("Test Task", "alice@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Test Task:alice@example.com" {
+		t.Errorf("Got %s://%s%s", uri.Scheme, uri.Host, uri.Path)
+	}
+
+	want := map[string]string{
+		"secret":    "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"issuer":    "Test Task",
+		"algorithm": "SHA1",
+		"digits":    "6",
+		"period":    "30",
+	}
+	for key, value := range want {
+		if got := uri.Query().Get(key); got != value {
+			t.Errorf("%s is %q, want %q", key, got, value)
+		}
+	}
+}